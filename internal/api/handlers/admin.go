@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"marketplace-app/internal/models"
 	"marketplace-app/internal/services"
 )
 
@@ -36,7 +40,7 @@ func (h *AdminHandler) GetAllTokens(c *gin.Context) {
 	// Get filter parameters
 	status := c.Query("status") // "valid", "expired", "all"
 
-	tokens, err := h.services.Token.GetAllTokenStatuses()
+	tokens, err := h.services.Token.GetAllTokenStatuses(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to retrieve token status",
@@ -93,7 +97,7 @@ func (h *AdminHandler) RefreshAllTokens(c *gin.Context) {
 	var errors []string
 
 	// Get all token statuses
-	tokens, err := h.services.Token.GetAllTokenStatuses()
+	tokens, err := h.services.Token.GetAllTokenStatuses(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to get token status",
@@ -109,7 +113,7 @@ func (h *AdminHandler) RefreshAllTokens(c *gin.Context) {
 
 		// Refresh if expired or if force is true
 		if !isValid || force {
-			err := h.services.Token.RefreshTokenForCompany(companyID)
+			err := h.services.Token.RefreshTokenForCompany(c.Request.Context(), companyID)
 			if err != nil {
 				errors = append(errors, companyID+": "+err.Error())
 			} else {
@@ -142,7 +146,7 @@ func (h *AdminHandler) CleanupExpiredTokens(c *gin.Context) {
 		days = 30
 	}
 
-	err := h.services.Token.CleanupExpiredTokens()
+	deleted, err := h.services.Token.CleanupExpiredTokens(c.Request.Context(), days)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to cleanup expired tokens",
@@ -154,6 +158,7 @@ func (h *AdminHandler) CleanupExpiredTokens(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Expired tokens cleaned up successfully",
 		"older_than_days": days,
+		"deleted_count": deleted,
 		"timestamp": time.Now().Unix(),
 	})
 }
@@ -170,6 +175,8 @@ func (h *AdminHandler) GetSchedulerStatus(c *gin.Context) {
 			"jobs_count": stats.JobCount,
 			"last_run": stats.LastJobTime,
 			"next_run": stats.NextJobTime,
+			"instance_id": stats.InstanceID,
+			"locks": stats.Locks,
 		},
 		"timestamp": time.Now().Unix(),
 	})
@@ -194,7 +201,7 @@ func (h *AdminHandler) StartScheduler(c *gin.Context) {
 
 // StopScheduler stops the scheduler service
 func (h *AdminHandler) StopScheduler(c *gin.Context) {
-	h.services.Scheduler.Stop()
+	h.services.Scheduler.Stop(c.Request.Context())
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Scheduler stopped successfully",
@@ -202,12 +209,46 @@ func (h *AdminHandler) StopScheduler(c *gin.Context) {
 	})
 }
 
-// AddSchedulerJob adds a new scheduled job
+// ListSchedulerJobs returns all persisted scheduler jobs
+func (h *AdminHandler) ListSchedulerJobs(c *gin.Context) {
+	jobs, err := h.services.Scheduler.ListJobs(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve scheduler jobs",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs": jobs,
+		"job_types": h.services.Scheduler.JobTypes(),
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// GetSchedulerJob returns a single scheduler job by name
+func (h *AdminHandler) GetSchedulerJob(c *gin.Context) {
+	job, err := h.services.Scheduler.GetJob(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		respondSchedulerJobError(c, "Failed to retrieve scheduled job", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job": job,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// AddSchedulerJob adds a new named, persisted scheduled job
 func (h *AdminHandler) AddSchedulerJob(c *gin.Context) {
 	var req struct {
-		Name     string `json:"name" binding:"required"`
-		Schedule string `json:"schedule" binding:"required"`
-		JobType  string `json:"job_type" binding:"required"`
+		Name       string         `json:"name" binding:"required"`
+		Spec       string         `json:"spec" binding:"required"`
+		JobType    string         `json:"job_type" binding:"required"`
+		Enabled    *bool          `json:"enabled"`
+		Parameters models.JSONMap `json:"parameters"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -215,53 +256,222 @@ func (h *AdminHandler) AddSchedulerJob(c *gin.Context) {
 		return
 	}
 
-	// Create job function based on type
-	var jobFunc func()
-	switch req.JobType {
-	case "token_refresh":
-		jobFunc = func() {
-			h.services.Token.RefreshExpiredTokens()
-		}
-	case "token_cleanup":
-		jobFunc = func() {
-			h.services.Token.CleanupExpiredTokens()
-		}
-	case "health_check":
-		jobFunc = func() {
-			// Perform health checks
-		}
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job type"})
+	job := &models.SchedulerJob{
+		Name:       req.Name,
+		Spec:       req.Spec,
+		JobType:    req.JobType,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		Parameters: req.Parameters,
+	}
+
+	if err := h.services.Scheduler.CreateJob(c.Request.Context(), job); err != nil {
+		respondSchedulerJobError(c, "Failed to add scheduled job", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Scheduled job added successfully",
+		"job": job,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// UpdateSchedulerJob changes the spec, type, enabled flag or parameters of a job
+func (h *AdminHandler) UpdateSchedulerJob(c *gin.Context) {
+	var req services.SchedulerJobUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.services.Scheduler.UpdateJob(c.Request.Context(), c.Param("name"), req)
+	if err != nil {
+		respondSchedulerJobError(c, "Failed to update scheduled job", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Scheduled job updated successfully",
+		"job": job,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// PauseSchedulerJob disables a job without deleting it
+func (h *AdminHandler) PauseSchedulerJob(c *gin.Context) {
+	h.setSchedulerJobEnabled(c, false)
+}
+
+// ResumeSchedulerJob re-enables a paused job
+func (h *AdminHandler) ResumeSchedulerJob(c *gin.Context) {
+	h.setSchedulerJobEnabled(c, true)
+}
+
+// RemoveSchedulerJob removes a scheduled job by name
+func (h *AdminHandler) RemoveSchedulerJob(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.services.Scheduler.DeleteJob(c.Request.Context(), name); err != nil {
+		respondSchedulerJobError(c, "Failed to remove scheduled job", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Scheduled job removed successfully",
+		"name": name,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// RunSchedulerJob runs a scheduled job immediately
+func (h *AdminHandler) RunSchedulerJob(c *gin.Context) {
+	name := c.Param("name")
+	startedAt := time.Now()
+
+	if err := h.services.Scheduler.RunJobNow(c.Request.Context(), name); err != nil {
+		respondSchedulerJobError(c, "Failed to run scheduled job", err)
 		return
 	}
 
-	_, err := h.services.Scheduler.AddJob(req.Schedule, jobFunc)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Scheduled job completed successfully",
+		"name": name,
+		"duration_ms": time.Since(startedAt).Milliseconds(),
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+func (h *AdminHandler) setSchedulerJobEnabled(c *gin.Context, enabled bool) {
+	job, err := h.services.Scheduler.SetJobEnabled(c.Request.Context(), c.Param("name"), enabled)
+	if err != nil {
+		respondSchedulerJobError(c, "Failed to update scheduled job", err)
+		return
+	}
+
+	message := "Scheduled job paused successfully"
+	if enabled {
+		message = "Scheduled job resumed successfully"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"job": job,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// GetSchedulerRuns returns job run history with optional filters
+func (h *AdminHandler) GetSchedulerRuns(c *gin.Context) {
+	// Parse pagination parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	filter := services.JobRunFilter{
+		JobName:    c.Query("job"),
+		Status:     c.Query("status"),
+		Trigger:    c.Query("trigger"),
+		InstanceID: c.Query("instance_id"),
+		Page:       page,
+		Limit:      limit,
+	}
+
+	var err error
+	if filter.Since, err = parseTimeQuery(c, "since"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Until, err = parseTimeQuery(c, "until"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	runs, total, err := h.services.Scheduler.ListRuns(c.Request.Context(), filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to add scheduled job",
+			"error": "Failed to retrieve job runs",
 			"details": err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Scheduled job added successfully",
-		"job": gin.H{
-			"name": req.Name,
-			"schedule": req.Schedule,
-			"job_type": req.JobType,
+	c.JSON(http.StatusOK, gin.H{
+		"runs": runs,
+		"pagination": gin.H{
+			"page": page,
+			"limit": limit,
+			"total": total,
+			"pages": (total + int64(limit) - 1) / int64(limit),
 		},
 		"timestamp": time.Now().Unix(),
 	})
 }
 
-// RemoveSchedulerJob removes a scheduled job
-func (h *AdminHandler) RemoveSchedulerJob(c *gin.Context) {
-	// Note: Job removal by name is not currently supported
-	// This would require maintaining a job name to EntryID mapping
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error": "Job removal by name is not currently implemented",
-		"message": "Use job entry ID for removal or restart scheduler to clear all jobs",
+// GetSchedulerHealth reports jobs that overran their interval or have not
+// succeeded in the given number of cycles
+func (h *AdminHandler) GetSchedulerHealth(c *gin.Context) {
+	cycles, _ := strconv.Atoi(c.DefaultQuery("cycles", "3"))
+	if cycles < 1 {
+		cycles = 3
+	}
+
+	jobs, err := h.services.Scheduler.GetJobHealth(c.Request.Context(), cycles)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to evaluate scheduler jobs",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	unhealthy := 0
+	for _, job := range jobs {
+		if !job.Healthy {
+			unhealthy++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs": jobs,
+		"cycles": cycles,
+		"unhealthy_count": unhealthy,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// parseTimeQuery parses an optional RFC3339 query parameter
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s parameter, expected RFC3339 timestamp: %w", name, err)
+	}
+	return &parsed, nil
+}
+
+// respondSchedulerJobError maps scheduler job errors to HTTP status codes
+func respondSchedulerJobError(c *gin.Context, message string, err error) {
+	statusCode := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		statusCode = http.StatusNotFound
+	case errors.Is(err, services.ErrJobExists), errors.Is(err, services.ErrJobRunning):
+		statusCode = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidJob):
+		statusCode = http.StatusBadRequest
+	}
+
+	c.JSON(statusCode, gin.H{
+		"error": message,
+		"details": err.Error(),
 	})
 }
 
@@ -269,7 +479,7 @@ func (h *AdminHandler) RemoveSchedulerJob(c *gin.Context) {
 
 // GetCacheStats returns cache statistics
 func (h *AdminHandler) GetCacheStats(c *gin.Context) {
-	stats := h.services.Cache.GetStats()
+	stats := h.services.Cache.GetStats(c.Request.Context())
 
 	c.JSON(http.StatusOK, gin.H{
 		"cache": stats,
@@ -277,44 +487,98 @@ func (h *AdminHandler) GetCacheStats(c *gin.Context) {
 	})
 }
 
-// ClearCache clears all cache entries
-func (h *AdminHandler) ClearCache(c *gin.Context) {
-	// Get pattern parameter for selective clearing
-	pattern := c.Query("pattern")
-
-	var err error
-
-	if pattern != "" {
-		// Clear cache entries matching pattern
-		err = h.services.Cache.DeletePattern(pattern)
-	} else {
-		// Clear all cache
-		err = h.services.Cache.FlushAll()
+// InspectCacheKey reports what each cache tier holds for a key, given
+// without the namespace prefix, e.g. ?key=company:<id>
+func (h *AdminHandler) InspectCacheKey(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key is required"})
+		return
 	}
 
+	inspection, err := h.services.Cache.Inspect(c.Request.Context(), key)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to clear cache",
+			"error": "Failed to inspect cache key",
 			"details": err.Error(),
 		})
 		return
 	}
 
-	response := gin.H{
-		"message": "Cache cleared successfully",
+	status := http.StatusOK
+	if !inspection.Found() {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"cache_key": inspection,
 		"timestamp": time.Now().Unix(),
+	})
+}
+
+// ClearCache clears cache entries in this service's namespace. A tag clears
+// the entries written with it; otherwise the given categories (comma
+// separated, default all) are flushed. With dry_run=true nothing is deleted
+// and the number of keys that would be is reported.
+func (h *AdminHandler) ClearCache(c *gin.Context) {
+	// Get tag parameter for selective clearing, e.g. company:<id>
+	tag := c.Query("tag")
+
+	if tag != "" {
+		// Clear cache entries written with the tag
+		if err := h.services.Cache.InvalidateTags(c.Request.Context(), tag); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to clear cache",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Cache cleared successfully",
+			"tag": tag,
+			"timestamp": time.Now().Unix(),
+		})
+		return
 	}
 
-	if pattern != "" {
-		response["pattern"] = pattern
+	var categories []string
+	for _, category := range strings.Split(c.Query("category"), ",") {
+		if category = strings.TrimSpace(category); category != "" {
+			categories = append(categories, category)
+		}
 	}
+	dryRun := c.Query("dry_run") == "true"
 
-	c.JSON(http.StatusOK, response)
+	result, err := h.services.Cache.Flush(c.Request.Context(), dryRun, categories...)
+	if err != nil {
+		status := http.StatusInternalServerError
+		response := gin.H{
+			"error": "Failed to clear cache",
+			"details": err.Error(),
+		}
+		if errors.Is(err, services.ErrUnknownCacheCategory) {
+			status = http.StatusBadRequest
+			response["valid_categories"] = services.CacheCategories()
+		}
+		c.JSON(status, response)
+		return
+	}
+
+	message := "Cache cleared successfully"
+	if dryRun {
+		message = "Dry run, no cache entries deleted"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"result": result,
+		"timestamp": time.Now().Unix(),
+	})
 }
 
 // GetCacheHealth checks cache health
 func (h *AdminHandler) GetCacheHealth(c *gin.Context) {
-	health := h.services.Cache.Health()
+	health := h.services.Cache.Health(c.Request.Context())
 
 	statusCode := http.StatusOK
 	if !health["redis"] && !health["memory_cache"] {
@@ -327,12 +591,145 @@ func (h *AdminHandler) GetCacheHealth(c *gin.Context) {
 	})
 }
 
+// Rate Limit Management
+
+// ListRateLimitPlans returns all rate limit plans
+func (h *AdminHandler) ListRateLimitPlans(c *gin.Context) {
+	plans, err := h.services.RateLimitPlans.ListPlans(c.Request.Context())
+	if err != nil {
+		respondRateLimitPlanError(c, "Failed to list rate limit plans", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plans": plans,
+		"count": len(plans),
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// CreateRateLimitPlan adds a rate limit plan. A plan named "default"
+// applies to every company without a plan.
+func (h *AdminHandler) CreateRateLimitPlan(c *gin.Context) {
+	var req struct {
+		Name              string  `json:"name" binding:"required"`
+		Description       string  `json:"description"`
+		RequestsPerSecond float64 `json:"requests_per_second" binding:"required"`
+		Burst             int     `json:"burst"`
+		DailyQuota        int64   `json:"daily_quota"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan := &models.RateLimitPlan{
+		Name:              req.Name,
+		Description:       req.Description,
+		RequestsPerSecond: req.RequestsPerSecond,
+		Burst:             req.Burst,
+		DailyQuota:        req.DailyQuota,
+	}
+
+	if err := h.services.RateLimitPlans.CreatePlan(c.Request.Context(), plan); err != nil {
+		respondRateLimitPlanError(c, "Failed to create rate limit plan", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Rate limit plan created successfully",
+		"plan": plan,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// UpdateRateLimitPlan changes the limits of a plan for every company on it
+func (h *AdminHandler) UpdateRateLimitPlan(c *gin.Context) {
+	var req services.RateLimitPlanUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, err := h.services.RateLimitPlans.UpdatePlan(c.Request.Context(), c.Param("name"), req)
+	if err != nil {
+		respondRateLimitPlanError(c, "Failed to update rate limit plan", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Rate limit plan updated successfully",
+		"plan": plan,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// AssignRateLimitPlan puts a company on a plan; an empty plan returns it
+// to the default plan
+func (h *AdminHandler) AssignRateLimitPlan(c *gin.Context) {
+	var req struct {
+		Plan string `json:"plan"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyID := c.Param("companyId")
+	limits, err := h.services.RateLimitPlans.AssignPlan(c.Request.Context(), companyID, req.Plan)
+	if err != nil {
+		respondRateLimitPlanError(c, "Failed to assign rate limit plan", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Rate limit plan assigned successfully",
+		"company_id": companyID,
+		"limits": limits,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// GetTenantUsage returns a company's rate limits, the requests in its
+// current window and its requests per day
+func (h *AdminHandler) GetTenantUsage(c *gin.Context) {
+	usage, err := h.services.RateLimitPlans.Usage(c.Request.Context(), c.Param("companyId"))
+	if err != nil {
+		respondRateLimitPlanError(c, "Failed to get tenant usage", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"usage": usage,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// respondRateLimitPlanError maps rate limit plan errors to HTTP status codes
+func respondRateLimitPlanError(c *gin.Context, message string, err error) {
+	statusCode := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrPlanNotFound), errors.Is(err, services.ErrCompanyNotFound):
+		statusCode = http.StatusNotFound
+	case errors.Is(err, services.ErrPlanExists):
+		statusCode = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidPlan):
+		statusCode = http.StatusBadRequest
+	}
+
+	c.JSON(statusCode, gin.H{
+		"error": message,
+		"details": err.Error(),
+	})
+}
+
 // System Management
 
 // GetSystemHealth returns overall system health
 func (h *AdminHandler) GetSystemHealth(c *gin.Context) {
 	// Check cache health
-	cacheHealth := h.services.Cache.Health()
+	cacheHealth := h.services.Cache.Health(c.Request.Context())
 
 	// Check scheduler health
 	schedulerStats := h.services.Scheduler.GetStats()
@@ -367,7 +764,7 @@ func (h *AdminHandler) GetSystemStats(c *gin.Context) {
 	productCount := 0 // TODO: Implement count methods
 
 	// Get token statistics
-	tokens, _ := h.services.Token.GetAllTokenStatuses()
+	tokens, _ := h.services.Token.GetAllTokenStatuses(c.Request.Context())
 	validTokens := 0
 	expiredTokens := 0
 	for _, token := range tokens {
@@ -379,7 +776,7 @@ func (h *AdminHandler) GetSystemStats(c *gin.Context) {
 	}
 
 	// Get cache statistics
-	cacheStats := h.services.Cache.GetStats()
+	cacheStats := h.services.Cache.GetStats(c.Request.Context())
 
 	// Get scheduler statistics
 	schedulerStats := h.services.Scheduler.GetStats()
@@ -406,8 +803,8 @@ func (h *AdminHandler) GetSystemStats(c *gin.Context) {
 
 // RestartServices restarts all background services
 func (h *AdminHandler) RestartServices(c *gin.Context) {
-	// Stop services
-	h.services.Stop()
+	// Stop the scheduler; alerts and the cache stay up while the process runs
+	h.services.Scheduler.Stop(c.Request.Context())
 
 	// Start services
 	err := h.services.Start()
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -43,7 +45,7 @@ func (h *AuthHandler) GetAuthURL(c *gin.Context) {
 
 	// Store state in cache for validation (expires in 10 minutes)
 	stateKey := fmt.Sprintf("oauth_state:%s", state)
-	h.services.Cache.Set(stateKey, companyID, 10*time.Minute)
+	services.SetJSON(c.Request.Context(), h.services.Cache, stateKey, companyID, 10*time.Minute)
 
 	// Use default redirect URI if not provided
 	redirectURI := redirectURL
@@ -87,7 +89,7 @@ func (h *AuthHandler) GetGoHighLevelAuthURL(c *gin.Context) {
 
 	// Store state and company_id in cache for validation (expires in 10 minutes)
 	stateKey := fmt.Sprintf("ghl_oauth_state:%s", state)
-	h.services.Cache.Set(stateKey, companyID, 10*time.Minute)
+	services.SetJSON(c.Request.Context(), h.services.Cache, stateKey, companyID, 10*time.Minute)
 
 	// Use default redirect URI if not provided
 	redirectURI := redirectURL
@@ -139,38 +141,21 @@ func (h *AuthHandler) HandleGoHighLevelCallback(c *gin.Context) {
 
 	// Validate state parameter
 	stateKey := fmt.Sprintf("ghl_oauth_state:%s", state)
-	cachedValue := h.services.Cache.Get(stateKey)
-	if cachedValue == nil {
+	companyID, ok := services.GetJSON[string](c.Request.Context(), h.services.Cache, stateKey)
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Invalid or expired state parameter",
 		})
 		return
 	}
 
-	// Get company ID from cached state
-	var companyID string
-	switch v := cachedValue.(type) {
-	case string:
-		companyID = v
-	case []byte:
-		companyID = string(v)
-	default:
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Invalid state data format",
-		})
-		return
-	}
-
 	// Clean up used state
-	h.services.Cache.Delete(stateKey)
+	h.services.Cache.Delete(c.Request.Context(), stateKey)
 
 	// Exchange code for access token with GoHighLevel
-	tokenResp, err := h.exchangeGoHighLevelToken(code, c.Query("redirect_uri"))
+	tokenResp, err := h.exchangeGoHighLevelToken(c.Request.Context(), code, c.Query("redirect_uri"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to exchange authorization code for token",
-			"details": err.Error(),
-		})
+		respondServiceError(c, "Failed to exchange authorization code for token", err)
 		return
 	}
 
@@ -217,40 +202,21 @@ func (h *AuthHandler) HandleOAuthCallback(c *gin.Context) {
 
 	// Validate state parameter
 	stateKey := fmt.Sprintf("oauth_state:%s", state)
-	cachedCompanyID := h.services.Cache.Get(stateKey)
-	if cachedCompanyID == nil {
+	companyID, ok := services.GetJSON[string](c.Request.Context(), h.services.Cache, stateKey)
+	if !ok || companyID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired state parameter"})
 		return
 	}
 
-	// Handle different types that might be returned from cache
-	var companyID string
-	switch v := cachedCompanyID.(type) {
-	case string:
-		companyID = v
-	case []byte:
-		companyID = string(v)
-	default:
-		// Try to convert to string
-		companyID = fmt.Sprintf("%v", v)
-		if companyID == "" || companyID == "<nil>" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid state data"})
-			return
-		}
-	}
-
 	// Process OAuth callback with Nango service
-	result, err := h.services.Nango.ProcessOAuthCallback(code)
+	result, err := h.services.Nango.ProcessOAuthCallback(c.Request.Context(), code)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to process OAuth callback",
-			"details": err.Error(),
-		})
+		respondServiceError(c, "Failed to process OAuth callback", err)
 		return
 	}
 
 	// Clean up state from cache
-	h.services.Cache.Delete(stateKey)
+	h.services.Cache.Delete(c.Request.Context(), stateKey)
 
 	// Generate JWT token for the company
 	jwtToken, err := h.generateJWTToken(companyID, result.AccessToken)
@@ -285,12 +251,9 @@ func (h *AuthHandler) ExchangeToken(c *gin.Context) {
 	}
 
 	// Fetch locations using the company token
-	locations, err := h.services.Nango.GetLocations(req.CompanyID)
+	locations, err := h.services.Nango.GetLocations(c.Request.Context(), req.CompanyID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to fetch locations",
-			"details": err.Error(),
-		})
+		respondServiceError(c, "Failed to fetch locations", err)
 		return
 	}
 
@@ -323,12 +286,9 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	// Refresh token using token service
-	err := h.services.Token.RefreshTokenForCompany(companyID)
+	err := h.services.Token.RefreshTokenForCompany(c.Request.Context(), companyID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to refresh token",
-			"details": err.Error(),
-		})
+		respondServiceError(c, "Failed to refresh token", err)
 		return
 	}
 
@@ -348,7 +308,7 @@ func (h *AuthHandler) GetTokenStatus(c *gin.Context) {
 	}
 
 	// Get token expiry information
-	expiry, err := h.services.Token.GetTokenExpiryInfo(companyID)
+	expiry, err := h.services.Token.GetTokenExpiryInfo(c.Request.Context(), companyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to get token status",
@@ -358,7 +318,7 @@ func (h *AuthHandler) GetTokenStatus(c *gin.Context) {
 	}
 
 	// Check if token is valid
-	isValid, _ := h.services.Token.ValidateToken(companyID)
+	isValid, _ := h.services.Token.ValidateToken(c.Request.Context(), companyID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"company_id": companyID,
@@ -434,7 +394,7 @@ type GoHighLevelTokenResponse struct {
 }
 
 // exchangeGoHighLevelToken exchanges authorization code for access token
-func (h *AuthHandler) exchangeGoHighLevelToken(code, redirectURI string) (*GoHighLevelTokenResponse, error) {
+func (h *AuthHandler) exchangeGoHighLevelToken(ctx context.Context, code, redirectURI string) (*GoHighLevelTokenResponse, error) {
 	// Use configured redirect URI if not provided
 	if redirectURI == "" {
 		redirectURI = h.config.GoHighLevelRedirectURI
@@ -451,8 +411,14 @@ func (h *AuthHandler) exchangeGoHighLevelToken(code, redirectURI string) (*GoHig
 		"user_type":     {"Company"}, // Default to Company, could be Location
 	}
 
-	// Make POST request
-	resp, err := http.PostForm(tokenURL, data)
+	// Make POST request through the shared upstream client
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := h.services.Upstream.Do(req, services.UpstreamTarget{Provider: services.ProviderGoHighLevel, Endpoint: "oauth_token"})
 	if err != nil {
 		return nil, fmt.Errorf("failed to make token request: %w", err)
 	}
@@ -466,7 +432,8 @@ func (h *AuthHandler) exchangeGoHighLevelToken(code, redirectURI string) (*GoHig
 
 	// Check for HTTP errors
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("token exchange failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("token exchange failed: %w",
+			services.ParseUpstreamError(services.ProviderGoHighLevel, resp, body))
 	}
 
 	// Parse JSON response
@@ -1,12 +1,16 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"marketplace-app/internal/models"
 	"marketplace-app/internal/services"
 )
@@ -25,20 +29,24 @@ func NewBusinessHandler(services *services.Services) *BusinessHandler {
 
 // GetCompany retrieves a company by ID
 func (h *BusinessHandler) GetCompany(c *gin.Context) {
-	companyID := c.Param("id")
+	companyID := c.Param("companyId")
 	if companyID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Company ID is required"})
 		return
 	}
 
-	company, err := h.services.Business.GetCompanyByID(companyID)
-	if err != nil {
+	company, err := h.services.Business.GetCompanyByID(c.Request.Context(), companyID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "Company not found",
 			"details": err.Error(),
 		})
 		return
 	}
+	if err != nil {
+		respondServiceError(c, "Failed to retrieve company", err)
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"company": company,
@@ -141,18 +149,15 @@ func (h *BusinessHandler) UpdateCompany(c *gin.Context) {
 
 // SyncCompanyData syncs company data from Nango
 func (h *BusinessHandler) SyncCompanyData(c *gin.Context) {
-	companyID := c.Param("id")
+	companyID := c.Param("companyId")
 	if companyID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Company ID is required"})
 		return
 	}
 
-	err := h.services.Business.SyncLocationData(companyID)
+	err := h.services.Business.SyncLocationData(c.Request.Context(), companyID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to sync company data",
-			"details": err.Error(),
-		})
+		respondServiceError(c, "Failed to sync company data", err)
 		return
 	}
 
@@ -167,7 +172,7 @@ func (h *BusinessHandler) SyncCompanyData(c *gin.Context) {
 
 // GetLocations retrieves locations for a company
 func (h *BusinessHandler) GetLocations(c *gin.Context) {
-	companyID := c.Param("company_id")
+	companyID := c.Param("companyId")
 	if companyID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Company ID is required"})
 		return
@@ -183,13 +188,10 @@ func (h *BusinessHandler) GetLocations(c *gin.Context) {
 		limit = 20
 	}
 
-	locations, err := h.services.Business.GetLocationsByCompany(companyID)
+	locations, err := h.services.Business.GetLocationsByCompany(c.Request.Context(), companyID)
 	total := int64(len(locations))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve locations",
-			"details": err.Error(),
-		})
+		respondServiceError(c, "Failed to retrieve locations", err)
 		return
 	}
 
@@ -205,15 +207,16 @@ func (h *BusinessHandler) GetLocations(c *gin.Context) {
 	})
 }
 
-// GetLocation retrieves a specific location
+// GetLocation retrieves a specific location. Its ETag names its version,
+// for use in If-Match when updating it.
 func (h *BusinessHandler) GetLocation(c *gin.Context) {
-	locationID := c.Param("id")
+	locationID := c.Param("locationId")
 	if locationID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Location ID is required"})
 		return
 	}
 
-	location, err := h.services.Business.GetLocationByID(locationID)
+	location, err := h.services.Business.GetLocationByID(c.Request.Context(), locationID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "Location not found",
@@ -222,11 +225,75 @@ func (h *BusinessHandler) GetLocation(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", locationETag(location))
 	c.JSON(http.StatusOK, gin.H{
 		"location": location,
 	})
 }
 
+// UpdateLocation changes the editable details of a location: PUT replaces
+// all of them and PATCH only those given. If-Match must carry the location's
+// current ETag, or * to update it whatever its version.
+func (h *BusinessHandler) UpdateLocation(c *gin.Context) {
+	locationID := c.Param("locationId")
+	if locationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Location ID is required"})
+		return
+	}
+	// Only the caller's own company's locations can be updated
+	claim, exists := c.Get("company_id")
+	if !exists || claim == nil || claim == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Token is not scoped to a company"})
+		return
+	}
+	companyID := fmt.Sprintf("%v", claim)
+
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required"})
+		return
+	}
+	version, ok := parseLocationETag(ifMatch)
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "If-Match does not match the location"})
+		return
+	}
+
+	// Unknown fields are refused rather than ignored, so clients learn that
+	// fields such as company_id cannot be changed
+	var update services.LocationUpdate
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid location update",
+			"details": err.Error(),
+		})
+		return
+	}
+	if c.Request.Method == http.MethodPut {
+		update = update.Replacement()
+	}
+
+	result, err := h.services.Business.UpdateLocation(c.Request.Context(), companyID, locationID, update, version)
+	if err != nil {
+		respondLocationUpdateError(c, err)
+		return
+	}
+
+	// The update is saved even when the CRM refused it
+	response := gin.H{
+		"message": "Location updated successfully",
+		"location": result.Location,
+		"upstream_synced": result.Pushed,
+	}
+	if result.PushError != nil {
+		response["upstream_error"] = result.PushError.Error()
+	}
+	c.Header("ETag", locationETag(result.Location))
+	c.JSON(http.StatusOK, response)
+}
+
 // CreateLocation creates a new location
 func (h *BusinessHandler) CreateLocation(c *gin.Context) {
 	var location models.Location
@@ -258,11 +325,11 @@ func (h *BusinessHandler) CreateLocation(c *gin.Context) {
 
 // Contact Handlers
 
-// GetContacts retrieves contacts for a company
+// GetContacts retrieves contacts for a location
 func (h *BusinessHandler) GetContacts(c *gin.Context) {
-	companyID := c.Param("company_id")
-	if companyID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company ID is required"})
+	locationID := c.Param("locationId")
+	if locationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Location ID is required"})
 		return
 	}
 
@@ -276,21 +343,23 @@ func (h *BusinessHandler) GetContacts(c *gin.Context) {
 		limit = 20
 	}
 
-	// TODO: Implement GetContactsByCompany method
-	contacts := []interface{}{}
-	total := int64(0)
-	err := error(nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve contacts",
+	contacts, err := h.services.Business.GetContactsByLocation(c.Request.Context(), locationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Location not found",
 			"details": err.Error(),
 		})
 		return
 	}
+	if err != nil {
+		respondServiceError(c, "Failed to retrieve contacts", err)
+		return
+	}
+	total := int64(len(contacts))
 
 	c.JSON(http.StatusOK, gin.H{
 		"contacts": contacts,
-		"company_id": companyID,
+		"location_id": locationID,
 		"pagination": gin.H{
 			"page": page,
 			"limit": limit,
@@ -313,8 +382,8 @@ func (h *BusinessHandler) CreateContact(c *gin.Context) {
 	contact.CreatedAt = now
 	contact.UpdatedAt = now
 
-	locationID := c.Param("location_id")
-	err := h.services.Business.CreateContact(locationID, &contact)
+	locationID := c.Param("locationId")
+	err := h.services.Business.CreateContact(c.Request.Context(), locationID, &contact)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create contact",
@@ -331,11 +400,11 @@ func (h *BusinessHandler) CreateContact(c *gin.Context) {
 
 // Product Handlers
 
-// GetProducts retrieves products for a company
+// GetProducts retrieves products for a location
 func (h *BusinessHandler) GetProducts(c *gin.Context) {
-	companyID := c.Param("company_id")
-	if companyID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Company ID is required"})
+	locationID := c.Param("locationId")
+	if locationID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Location ID is required"})
 		return
 	}
 
@@ -349,37 +418,30 @@ func (h *BusinessHandler) GetProducts(c *gin.Context) {
 		limit = 20
 	}
 
-	// Optional location filter
-	locationID := c.Query("location_id")
-
-	// TODO: Implement GetProductsByCompany method
-	products := []interface{}{}
-	total := int64(0)
-	err := error(nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to retrieve products",
+	products, err := h.services.Business.GetProductsByLocation(c.Request.Context(), locationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Location not found",
 			"details": err.Error(),
 		})
 		return
 	}
+	if err != nil {
+		respondServiceError(c, "Failed to retrieve products", err)
+		return
+	}
+	total := int64(len(products))
 
-	response := gin.H{
+	c.JSON(http.StatusOK, gin.H{
 		"products": products,
-		"company_id": companyID,
+		"location_id": locationID,
 		"pagination": gin.H{
 			"page": page,
 			"limit": limit,
 			"total": total,
 			"pages": (total + int64(limit) - 1) / int64(limit),
 		},
-	}
-
-	if locationID != "" {
-		response["location_id"] = locationID
-	}
-
-	c.JSON(http.StatusOK, response)
+	})
 }
 
 // CreateProduct creates a new product
@@ -395,8 +457,8 @@ func (h *BusinessHandler) CreateProduct(c *gin.Context) {
 	product.CreatedAt = now
 	product.UpdatedAt = now
 
-	locationID := c.Param("location_id")
-	err := h.services.Business.CreateProduct(locationID, &product)
+	locationID := c.Param("locationId")
+	err := h.services.Business.CreateProduct(c.Request.Context(), locationID, &product)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to create product",
@@ -420,7 +482,7 @@ func (h *BusinessHandler) GetBusinessSummary(c *gin.Context) {
 	}
 
 	// Get company
-	company, err := h.services.Business.GetCompanyByID(companyID)
+	company, err := h.services.Business.GetCompanyByID(c.Request.Context(), companyID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "Company not found",
@@ -435,8 +497,8 @@ func (h *BusinessHandler) GetBusinessSummary(c *gin.Context) {
 	productsCount := int64(0) // TODO: Implement GetProductCount method
 
 	// Get token status
-	isTokenValid, _ := h.services.Token.ValidateToken(companyID)
-	tokenExpiry, _ := h.services.Token.GetTokenExpiryInfo(companyID)
+	isTokenValid, _ := h.services.Token.ValidateToken(c.Request.Context(), companyID)
+	tokenExpiry, _ := h.services.Token.GetTokenExpiryInfo(c.Request.Context(), companyID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"company": company,
@@ -449,4 +511,47 @@ func (h *BusinessHandler) GetBusinessSummary(c *gin.Context) {
 			"last_sync": company.UpdatedAt,
 		},
 	})
+}
+
+// locationETag is the ETag of a location's version
+func locationETag(location *models.Location) string {
+	return fmt.Sprintf(`"v%d"`, location.Version)
+}
+
+// parseLocationETag returns the version an If-Match header names, or 0 for
+// any version. Weak ETags never match, as If-Match compares strongly.
+func parseLocationETag(ifMatch string) (int64, bool) {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "*" {
+		return 0, true
+	}
+	if !strings.HasPrefix(ifMatch, `"v`) || !strings.HasSuffix(ifMatch, `"`) {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(ifMatch[2:len(ifMatch)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// respondLocationUpdateError maps location update errors to HTTP status codes
+func respondLocationUpdateError(c *gin.Context, err error) {
+	statusCode := 0
+	switch {
+	case errors.Is(err, services.ErrInvalidLocation):
+		statusCode = http.StatusBadRequest
+	case errors.Is(err, services.ErrLocationNotFound):
+		statusCode = http.StatusNotFound
+	case errors.Is(err, services.ErrLocationVersionMismatch):
+		statusCode = http.StatusPreconditionFailed
+	default:
+		respondServiceError(c, "Failed to update location", err)
+		return
+	}
+
+	c.JSON(statusCode, gin.H{
+		"error": "Failed to update location",
+		"details": err.Error(),
+	})
 }
\ No newline at end of file
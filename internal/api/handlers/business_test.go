@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"marketplace-app/internal/config"
+	"marketplace-app/internal/services"
+)
+
+// newTestBusinessHandler returns a handler whose business service reads a
+// sqlmock database through a memory-only cache
+func newTestBusinessHandler(t *testing.T) (*BusinessHandler, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	cfg := &config.Config{RedisURL: "redis://127.0.0.1:1", CacheExpiration: 5, CacheKeyPrefix: "test:"}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cache := services.NewCacheService(cfg, log)
+	t.Cleanup(cache.Close)
+	return NewBusinessHandler(&services.Services{
+		Cache:    cache,
+		Business: services.NewBusinessService(db, cfg, nil, cache, log),
+		Logger:   log,
+	}), mock
+}
+
+func TestGetCompanyErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		queryErr   error
+		wantStatus int
+	}{
+		{"missing", nil, http.StatusNotFound},
+		{"timeout", context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{"database down", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mock := newTestBusinessHandler(t)
+			query := mock.ExpectQuery(`SELECT \* FROM "companies"`)
+			if tt.queryErr != nil {
+				query.WillReturnError(tt.queryErr)
+			} else {
+				query.WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			}
+
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/companies/company-1", nil)
+			c.Params = gin.Params{{Key: "companyId", Value: "company-1"}}
+
+			handler.GetCompany(c)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestParseLocationETag(t *testing.T) {
+	tests := []struct {
+		ifMatch     string
+		wantVersion int64
+		wantOK      bool
+	}{
+		{`"v3"`, 3, true},
+		{` "v12" `, 12, true},
+		{`*`, 0, true},
+		{`W/"v3"`, 0, false},
+		{`"v0"`, 0, false},
+		{`"v-1"`, 0, false},
+		{`"3"`, 0, false},
+		{`v3`, 0, false},
+		{`"vx"`, 0, false},
+	}
+	for _, tt := range tests {
+		version, ok := parseLocationETag(tt.ifMatch)
+		if version != tt.wantVersion || ok != tt.wantOK {
+			t.Errorf("parseLocationETag(%s) = %d, %v, want %d, %v", tt.ifMatch, version, ok, tt.wantVersion, tt.wantOK)
+		}
+	}
+}
+
+func TestUpdateLocationPreconditions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewBusinessHandler(&services.Services{})
+
+	tests := []struct {
+		name       string
+		companyID  interface{}
+		ifMatch    string
+		wantStatus int
+	}{
+		{"no company", nil, `"v1"`, http.StatusForbidden},
+		{"no If-Match", "company-1", "", http.StatusPreconditionRequired},
+		{"weak If-Match", "company-1", `W/"v1"`, http.StatusPreconditionFailed},
+		{"malformed If-Match", "company-1", `"1"`, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPatch, "/api/v1/locations/loc-1", strings.NewReader(`{"city":"Springfield"}`))
+			if tt.ifMatch != "" {
+				c.Request.Header.Set("If-Match", tt.ifMatch)
+			}
+			c.Params = gin.Params{{Key: "locationId", Value: "loc-1"}}
+			if tt.companyID != nil {
+				c.Set("company_id", tt.companyID)
+			}
+
+			handler.UpdateLocation(c)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRespondLocationUpdateError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := map[error]int{
+		fmt.Errorf("%w: no fields to update", services.ErrInvalidLocation):                     http.StatusBadRequest,
+		services.ErrLocationNotFound:                                                           http.StatusNotFound,
+		fmt.Errorf("%w: location is at version 4, not 3", services.ErrLocationVersionMismatch): http.StatusPreconditionFailed,
+	}
+	for err, wantStatus := range tests {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		respondLocationUpdateError(c, err)
+		if recorder.Code != wantStatus {
+			t.Errorf("%v: got status %d, want %d", err, recorder.Code, wantStatus)
+		}
+	}
+}
\ No newline at end of file
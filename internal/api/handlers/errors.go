@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"marketplace-app/internal/services"
+)
+
+// respondServiceError writes an error response for a failed service call.
+// Upstream provider failures are mapped to the status the client should act
+// on: rejected credentials become 502 with a reauth_required code, missing
+// upstream resources 404, upstream rate limiting 503 with Retry-After, and
+// an open circuit breaker 503. A request that ran past its deadline is a 504;
+// anything else is a 500.
+func respondServiceError(c *gin.Context, message string, err error) {
+	statusCode := http.StatusInternalServerError
+	response := gin.H{
+		"error":   message,
+		"details": err.Error(),
+	}
+
+	upstreamErr, isUpstream := services.AsUpstreamError(err)
+	if isUpstream {
+		response["upstream"] = gin.H{
+			"provider":    upstreamErr.Provider,
+			"status_code": upstreamErr.StatusCode,
+			"code":        upstreamErr.Code,
+			"message":     upstreamErr.Message,
+			"request_id":  upstreamErr.RequestID,
+		}
+
+		switch upstreamErr.StatusCode {
+		case http.StatusUnauthorized:
+			statusCode = http.StatusBadGateway
+			response["code"] = "reauth_required"
+		case http.StatusNotFound:
+			statusCode = http.StatusNotFound
+		case http.StatusTooManyRequests:
+			statusCode = http.StatusServiceUnavailable
+			if upstreamErr.RetryAfter > 0 {
+				retryAfter := int(math.Ceil(upstreamErr.RetryAfter.Seconds()))
+				c.Header("Retry-After", strconv.Itoa(retryAfter))
+				response["retry_after"] = retryAfter
+			}
+		default:
+			statusCode = http.StatusBadGateway
+		}
+	}
+
+	if errors.Is(err, services.ErrCircuitOpen) {
+		statusCode = http.StatusServiceUnavailable
+		response["code"] = "upstream_unavailable"
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		statusCode = http.StatusGatewayTimeout
+	}
+
+	if errors.Is(err, services.ErrReauthRequired) {
+		statusCode = http.StatusBadGateway
+		response["code"] = "reauth_required"
+	}
+
+	c.JSON(statusCode, response)
+}
@@ -33,11 +33,14 @@ func (h *HealthHandler) BasicHealth(c *gin.Context) {
 
 // DetailedHealth returns comprehensive health information
 func (h *HealthHandler) DetailedHealth(c *gin.Context) {
-	// Check database health (TODO: implement database health check)
-	dbHealthy := true
+	ctx := c.Request.Context()
 
-	// Check cache health (TODO: implement cache health check)
-	cacheHealth := true
+	// Check database and cache health
+	dbHealth := h.services.Health.CheckDatabase(ctx)
+	cacheHealth := h.services.Health.CheckCache(ctx)
+
+	// Check provider reachability (cached between probes)
+	upstreamHealth := h.services.Health.CheckUpstream(ctx)
 
 	// Check scheduler health
 	schedulerStats := h.services.Scheduler.GetStats()
@@ -47,8 +50,16 @@ func (h *HealthHandler) DetailedHealth(c *gin.Context) {
 	var memStats runtime.MemStats
 	runtime.ReadMemStats(&memStats)
 
-	// Calculate overall health
-	allHealthy := dbHealthy && cacheHealth && schedulerHealthy
+	// Calculate overall health; an unreachable provider degrades the
+	// service but does not make it unhealthy
+	allHealthy := dbHealth.Healthy && cacheHealth.Healthy && schedulerHealthy
+	degraded := dbHealth.Status == services.HealthStatusDegraded ||
+		cacheHealth.Status == services.HealthStatusDegraded
+	for _, provider := range upstreamHealth {
+		if provider.Status != services.HealthStatusHealthy {
+			degraded = true
+		}
+	}
 
 	// Determine HTTP status code
 	statusCode := http.StatusOK
@@ -59,33 +70,20 @@ func (h *HealthHandler) DetailedHealth(c *gin.Context) {
 	// Build response
 	response := gin.H{
 		"status": func() string {
-			if allHealthy {
-				return "healthy"
+			if !allHealthy {
+				return services.HealthStatusUnhealthy
+			}
+			if degraded {
+				return services.HealthStatusDegraded
 			}
-			return "unhealthy"
+			return services.HealthStatusHealthy
 		}(),
 		"timestamp": time.Now().Unix(),
 		"uptime": time.Since(h.startTime).Seconds(),
 		"version": "1.0.0",
 		"components": gin.H{
-			"database": gin.H{
-				"status": func() string {
-					if dbHealthy {
-						return "healthy"
-					}
-					return "unhealthy"
-				}(),
-				"healthy": dbHealthy,
-			},
-			"cache": gin.H{
-				"status": func() string {
-					if cacheHealth {
-						return "healthy"
-					}
-					return "unhealthy"
-				}(),
-				"healthy": cacheHealth,
-			},
+			"database": dbHealth,
+			"cache": cacheHealth,
 			"scheduler": gin.H{
 				"status": func() string {
 					if schedulerHealthy {
@@ -96,6 +94,10 @@ func (h *HealthHandler) DetailedHealth(c *gin.Context) {
 				"healthy": schedulerHealthy,
 				"details": schedulerStats,
 			},
+			"upstream": gin.H{
+				"providers": upstreamHealth,
+				"circuit_breakers": h.services.Upstream.BreakerStats(),
+			},
 		},
 		"system": gin.H{
 			"go_version": runtime.Version(),
@@ -115,26 +117,37 @@ func (h *HealthHandler) DetailedHealth(c *gin.Context) {
 
 // ReadinessCheck checks if the application is ready to serve traffic
 func (h *HealthHandler) ReadinessCheck(c *gin.Context) {
-	// Check database health (TODO: implement database health check)
-	dbHealthy := true
+	ctx := c.Request.Context()
 
-	// Check cache health (TODO: implement cache health check)
-	cacheHealthy := true
+	// Check database and cache health
+	dbHealth := h.services.Health.CheckDatabase(ctx)
+	cacheHealth := h.services.Health.CheckCache(ctx)
 
-	// Application is ready if database and cache are available
-	ready := dbHealthy && cacheHealthy
+	// Application is ready if the database is available and it is not
+	// draining for shutdown. Without Redis the cache, rate limiter and locks
+	// fall back to memory and Postgres, so losing it only degrades the
+	// instance; failing readiness on it would pull every replica at once.
+	draining := h.services.Draining()
+	ready := dbHealth.Healthy && !draining
 
+	status := services.HealthStatusHealthy
 	statusCode := http.StatusOK
-	if !ready {
+	switch {
+	case !ready:
+		status = services.HealthStatusUnhealthy
 		statusCode = http.StatusServiceUnavailable
+	case !cacheHealth.Healthy || cacheHealth.Status == services.HealthStatusDegraded:
+		status = services.HealthStatusDegraded
 	}
 
 	c.JSON(statusCode, gin.H{
 		"ready": ready,
+		"status": status,
+		"draining": draining,
 		"timestamp": time.Now().Unix(),
 		"checks": gin.H{
-			"database": dbHealthy,
-			"cache": cacheHealthy,
+			"database": dbHealth.Healthy,
+			"cache": cacheHealth.Healthy,
 		},
 	})
 }
@@ -149,106 +162,44 @@ func (h *HealthHandler) LivenessCheck(c *gin.Context) {
 	})
 }
 
-// MetricsEndpoint returns application metrics
-func (h *HealthHandler) MetricsEndpoint(c *gin.Context) {
-	// Get business metrics (TODO: implement count methods)
-	companyCount := 0
-	locationCount := 0
-	contactCount := 0
-	productCount := 0
-
-	// Get token metrics
-	tokens, _ := h.services.Token.GetAllTokenStatuses()
-	validTokens := 0
-	expiredTokens := 0
-	for _, token := range tokens {
-		if !token.IsExpired {
-			validTokens++
-		} else {
-			expiredTokens++
-		}
-	}
-
-	// Get cache metrics
-	cacheStats := h.services.Cache.GetStats()
-
-	// Get scheduler metrics
-	schedulerStats := h.services.Scheduler.GetStats()
-
-	// Get system metrics
-	var memStats runtime.MemStats
-	runtime.ReadMemStats(&memStats)
-
-	c.JSON(http.StatusOK, gin.H{
-		"metrics": gin.H{
-			"business": gin.H{
-				"companies_total": companyCount,
-				"locations_total": locationCount,
-				"contacts_total": contactCount,
-				"products_total": productCount,
-			},
-			"tokens": gin.H{
-				"total": len(tokens),
-				"valid": validTokens,
-				"expired": expiredTokens,
-				"valid_percentage": func() float64 {
-					if len(tokens) == 0 {
-						return 0
-					}
-					return float64(validTokens) / float64(len(tokens)) * 100
-				}(),
-			},
-			"cache": cacheStats,
-			"scheduler": schedulerStats,
-			"system": gin.H{
-				"uptime_seconds": time.Since(h.startTime).Seconds(),
-				"goroutines": runtime.NumGoroutine(),
-				"memory_alloc_mb": bToMb(memStats.Alloc),
-				"memory_sys_mb": bToMb(memStats.Sys),
-				"gc_cycles": memStats.NumGC,
-				"cpu_count": runtime.NumCPU(),
-			},
-		},
-		"timestamp": time.Now().Unix(),
-	})
-}
-
-// DatabaseHealth checks database connectivity
+// DatabaseHealth checks database connectivity and connection pool usage
 func (h *HealthHandler) DatabaseHealth(c *gin.Context) {
-	// TODO: Implement database health check
-	healthy := true
+	health := h.services.Health.CheckDatabase(c.Request.Context())
 
 	statusCode := http.StatusOK
-	if !healthy {
+	if !health.Healthy {
 		statusCode = http.StatusServiceUnavailable
 	}
 
 	c.JSON(statusCode, gin.H{
-		"database": gin.H{
-			"healthy": healthy,
-			"status": func() string {
-				if healthy {
-					return "connected"
-				}
-				return "disconnected"
-			}(),
-		},
+		"database": health,
 		"timestamp": time.Now().Unix(),
 	})
 }
 
 // CacheHealth checks cache connectivity
 func (h *HealthHandler) CacheHealth(c *gin.Context) {
-	// TODO: Implement cache health check
-	health := true
+	health := h.services.Health.CheckCache(c.Request.Context())
 
 	statusCode := http.StatusOK
-	if !health {
+	if !health.Healthy {
 		statusCode = http.StatusServiceUnavailable
 	}
 
 	c.JSON(statusCode, gin.H{
-		"cache": gin.H{"healthy": health},
+		"cache": health,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// UpstreamHealth checks provider reachability. Providers are outside our
+// control, so an unreachable one is reported without failing the check.
+func (h *HealthHandler) UpstreamHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"upstream": gin.H{
+			"providers": h.services.Health.CheckUpstream(c.Request.Context()),
+			"circuit_breakers": h.services.Upstream.BreakerStats(),
+		},
 		"timestamp": time.Now().Unix(),
 	})
 }
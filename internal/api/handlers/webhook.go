@@ -1,10 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -68,8 +68,8 @@ func (h *WebhookHandler) NangoTokenRefresh(c *gin.Context) {
 	}
 
 	// Log the webhook event
-	fmt.Printf("Token refresh webhook processed for company %s at %v\n", 
-		payload.CompanyID, payload.Timestamp)
+	h.services.Logger.InfoContext(c.Request.Context(), "Token refresh webhook processed",
+		"company_id", payload.CompanyID, "event_time", payload.Timestamp)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Token refresh processed successfully",
@@ -155,11 +155,11 @@ func (h *WebhookHandler) NangoCompanyUpdate(c *gin.Context) {
 	}
 
 	// Invalidate relevant cache entries
-	h.invalidateCompanyCache(payload.CompanyID)
+	h.invalidateCompanyCache(c.Request.Context(), payload.CompanyID)
 
 	// Log the webhook event
-	fmt.Printf("Company update webhook processed: %s for company %s, updated %d records at %v\n", 
-		payload.Event, payload.CompanyID, updatedCount, payload.Timestamp)
+	h.services.Logger.InfoContext(c.Request.Context(), "Company update webhook processed",
+		"event", payload.Event, "company_id", payload.CompanyID, "updated", updatedCount, "event_time", payload.Timestamp)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Company update processed successfully",
@@ -238,18 +238,19 @@ func (h *WebhookHandler) NangoConnectionStatus(c *gin.Context) {
 
 	case "connection.failed":
 		// Log connection failure
-		fmt.Printf("Connection failed for company %s: %s\n", payload.CompanyID, payload.Reason)
+		h.services.Logger.WarnContext(c.Request.Context(), "Connection failed",
+			"company_id", payload.CompanyID, "reason", payload.Reason)
 		
 		// Optionally mark tokens as expired if connection consistently fails
 		// TODO: Implement MarkTokenExpired method
 	}
 
 	// Invalidate cache
-	h.invalidateCompanyCache(payload.CompanyID)
+	h.invalidateCompanyCache(c.Request.Context(), payload.CompanyID)
 
 	// Log the webhook event
-	fmt.Printf("Connection status webhook processed: %s for company %s, status: %s at %v\n", 
-		payload.Event, payload.CompanyID, payload.Status, payload.Timestamp)
+	h.services.Logger.InfoContext(c.Request.Context(), "Connection status webhook processed",
+		"event", payload.Event, "company_id", payload.CompanyID, "status", payload.Status, "event_time", payload.Timestamp)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Connection status processed successfully",
@@ -278,7 +279,8 @@ func (h *WebhookHandler) GenericWebhook(c *gin.Context) {
 	// Log the webhook event
 	event, _ := payload["event"].(string)
 	companyID, _ := payload["company_id"].(string)
-	fmt.Printf("Generic webhook received: %s for company %s\n", event, companyID)
+	h.services.Logger.InfoContext(c.Request.Context(), "Generic webhook received",
+		"event", event, "company_id", companyID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Webhook received successfully",
@@ -320,23 +322,18 @@ func (h *WebhookHandler) verifyNangoSignature(c *gin.Context) bool {
 }
 
 // invalidateCompanyCache invalidates cache entries for a company
-func (h *WebhookHandler) invalidateCompanyCache(companyID string) {
-	// Define cache patterns to invalidate
-	patterns := []string{
-		fmt.Sprintf("company:%s", companyID),
-		fmt.Sprintf("locations:%s", companyID),
-		fmt.Sprintf("contacts:%s", companyID),
-		fmt.Sprintf("products:%s", companyID),
-		fmt.Sprintf("business_summary:%s", companyID),
+func (h *WebhookHandler) invalidateCompanyCache(ctx context.Context, companyID string) {
+	// Without a database the company's locations are unknown, so only
+	// entries tagged with the company itself can be dropped
+	var err error
+	if h.services.Business != nil {
+		err = h.services.Business.InvalidateCompany(ctx, companyID)
+	} else {
+		err = h.services.Cache.InvalidateTags(ctx, services.CompanyTag(companyID))
 	}
-
-	// Invalidate each pattern
-	for _, pattern := range patterns {
-		h.services.Cache.Delete(pattern)
+	if err != nil {
+		h.services.Logger.WarnContext(ctx, "Failed to invalidate company cache", "company_id", companyID, "error", err)
 	}
-
-	// Also clear any cached API responses for this company
-	// TODO: Implement ClearPattern method
 }
 
 // WebhookHealth returns webhook endpoint health status
@@ -1,8 +1,15 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"runtime/debug"
 	"strconv"
 	"strings"
 	"time"
@@ -10,7 +17,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"marketplace-app/internal/logging"
+	"marketplace-app/internal/metrics"
 	"marketplace-app/internal/services"
+	"marketplace-app/internal/telemetry"
 )
 
 // AuthMiddleware validates JWT tokens and sets user context
@@ -55,6 +67,10 @@ func AuthMiddleware(services *services.Services) gin.HandlerFunc {
 			c.Set("company_id", claims["company_id"])
 			c.Set("user_id", claims["user_id"])
 			c.Set("token_exp", claims["exp"])
+
+			// Include the tenant in every log record for the request
+			c.Request = c.Request.WithContext(logging.WithFields(c.Request.Context(),
+				slog.Any("company_id", claims["company_id"])))
 		} else {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
@@ -88,51 +104,110 @@ func AdminMiddleware() gin.HandlerFunc {
 	}
 }
 
-// RateLimitMiddleware implements rate limiting using Redis
+// RateLimitMiddleware limits requests per client IP over a sliding window.
+// It runs before authentication, so the IP is the only identity available;
+// TenantRateLimitMiddleware limits authenticated requests per company.
 func RateLimitMiddleware(services *services.Services) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get client identifier (IP or user ID)
-		clientID := getClientID(c)
-		
-		// Rate limit key
-		rateKey := fmt.Sprintf("rate_limit:%s", clientID)
-		
-		// Get current request count
-		currentCount, err := services.Cache.Increment(rateKey, 1)
-		if err != nil {
-			// If cache fails, allow the request but log the error
-			fmt.Printf("Rate limit cache error: %v\n", err)
+		limiter := services.RateLimit
+		if limiter == nil || !limiter.Enabled() {
 			c.Next()
 			return
 		}
 
-		// Set expiration for the key (1 minute window)
-		if currentCount == 1 {
-			services.Cache.SetExpiration(rateKey, time.Minute)
+		result := limiter.Allow(c.Request.Context(), fmt.Sprintf("ip:%s", c.ClientIP()), limiter.Limit())
+		if !allowRateLimited(c, "ip", result) {
+			return
 		}
+		c.Next()
+	}
+}
 
-		// Check rate limit (100 requests per minute by default)
-		rateLimit := int64(100) // This should come from config
-		if currentCount > rateLimit {
-			c.Header("X-RateLimit-Limit", strconv.FormatInt(rateLimit, 10))
-			c.Header("X-RateLimit-Remaining", "0")
-			c.Header("Retry-After", "60")
+// TenantRateLimitMiddleware enforces the company's rate limit plan: its
+// sliding window, burst and daily quota. It must run after AuthMiddleware;
+// tokens without a company are only limited by IP.
+func TenantRateLimitMiddleware(services *services.Services) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter := services.RateLimit
+		claim, exists := c.Get("company_id")
+		if limiter == nil || !limiter.Enabled() || !exists || claim == nil || claim == "" {
+			c.Next()
+			return
+		}
+		companyID := fmt.Sprintf("%v", claim)
+		ctx := c.Request.Context()
+
+		limits := limiter.DefaultLimits()
+		if services.RateLimitPlans != nil {
+			planLimits, err := services.RateLimitPlans.LimitsForCompany(ctx, companyID)
+			if err != nil {
+				services.Logger.WarnContext(ctx, "Failed to load rate limit plan, using default limits", "error", err)
+			} else {
+				limits = planLimits
+			}
+		}
+
+		// The quota is checked first so requests it refuses take no window
+		// slot, and a request the windows refuse gets its quota back
+		quota := limiter.ConsumeTenantQuota(ctx, companyID, limits)
+		if !quota.Allowed {
+			setQuotaHeaders(c, quota)
+			resetSeconds := int(math.Ceil(quota.Reset.Seconds()))
+			metrics.RateLimitRejectionsTotal.WithLabelValues("quota").Inc()
+			c.Header("Retry-After", strconv.Itoa(resetSeconds))
 			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded",
-				"retry_after": 60,
+				"error": "Daily quota exceeded",
+				"retry_after": resetSeconds,
 			})
 			c.Abort()
 			return
 		}
 
-		// Set rate limit headers
-		c.Header("X-RateLimit-Limit", strconv.FormatInt(rateLimit, 10))
-		c.Header("X-RateLimit-Remaining", strconv.FormatInt(rateLimit-currentCount, 10))
+		result := limiter.AllowWindows(ctx, limiter.TenantWindows(companyID, limits)...)
+		if !result.Allowed {
+			quota = limiter.RefundQuota(ctx, quota)
+		}
+		setQuotaHeaders(c, quota)
+		if !allowRateLimited(c, "tenant", result) {
+			return
+		}
 
 		c.Next()
 	}
 }
 
+// setQuotaHeaders sets the X-Quota headers for a limited daily quota
+func setQuotaHeaders(c *gin.Context, quota services.QuotaResult) {
+	if quota.Limit <= 0 {
+		return
+	}
+	c.Header("X-Quota-Limit", strconv.FormatInt(quota.Limit, 10))
+	c.Header("X-Quota-Remaining", strconv.FormatInt(quota.Remaining(), 10))
+	c.Header("X-Quota-Reset", strconv.Itoa(int(math.Ceil(quota.Reset.Seconds()))))
+}
+
+// allowRateLimited sets the X-RateLimit headers for result and, when the
+// request was refused, responds with 429 and reports false
+func allowRateLimited(c *gin.Context, scope string, result services.RateLimitResult) bool {
+	resetSeconds := int(math.Ceil(result.Reset.Seconds()))
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(resetSeconds))
+
+	if !result.Allowed {
+		metrics.RateLimitRejectionsTotal.WithLabelValues(scope).Inc()
+		c.Header("Retry-After", strconv.Itoa(resetSeconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "Rate limit exceeded",
+			"retry_after": resetSeconds,
+		})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
 // RequestIDMiddleware adds a unique request ID to each request
 func RequestIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -147,7 +222,106 @@ func RequestIDMiddleware() gin.HandlerFunc {
 		c.Set("request_id", requestID)
 		c.Header("X-Request-ID", requestID)
 
+		// Carry it on the request context so services, queries and outbound
+		// calls can be correlated with the request span
+		c.Request = c.Request.WithContext(telemetry.WithRequestID(c.Request.Context(), requestID))
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("request.id", requestID))
+
+		c.Next()
+	}
+}
+
+// TimeoutMiddleware puts a deadline on the request context so database and
+// upstream work done for the request is cancelled once it passes
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if ctx.Err() == context.DeadlineExceeded && !c.Writer.Written() {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+				"error": "Request timed out",
+				"timeout_seconds": timeout.Seconds(),
+			})
+		}
+	}
+}
+
+// LoggingMiddleware logs each request once it completes and adds the route
+// to the log fields of the request context. Successful probe and metrics
+// requests are logged at debug level to keep them out of normal output.
+func LoggingMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		c.Request = c.Request.WithContext(logging.WithFields(c.Request.Context(), slog.String("route", route)))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		case quietRoutes[route]:
+			level = slog.LevelDebug
+		}
+
+		// The query string is not logged; OAuth callbacks carry codes in it
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		logger.LogAttrs(c.Request.Context(), level, "Request completed", attrs...)
+	}
+}
+
+// quietRoutes are polled by probes and scrapers
+var quietRoutes = map[string]bool{
+	"/health":        true,
+	"/ready":         true,
+	"/live":          true,
+	"/metrics":       true,
+	"/api/v1/health": true,
+}
+
+// MetricsMiddleware records request counts and latency by route template
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
 		c.Next()
+
+		// Label by route template rather than path to bound cardinality
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.HTTPRequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).
+			Observe(time.Since(start).Seconds())
 	}
 }
 
@@ -171,8 +345,9 @@ func ErrorHandlingMiddleware() gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
 		requestID, _ := c.Get("request_id")
 		
-		// Log the error with request ID
-		fmt.Printf("PANIC [%v]: %v\n", requestID, recovered)
+		// Log the error; the request ID comes from the request context
+		slog.ErrorContext(c.Request.Context(), "Panic recovered", "panic", fmt.Sprint(recovered),
+			"stack", string(debug.Stack()))
 
 		// Return generic error response
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -182,96 +357,163 @@ func ErrorHandlingMiddleware() gin.HandlerFunc {
 	})
 }
 
-// CacheMiddleware adds caching for GET requests
-func CacheMiddleware(services *services.Services, duration time.Duration) gin.HandlerFunc {
+// CacheMiddleware caches successful GET responses per tenant, path and
+// query for ttl, tagged with tags(c) so that invalidating the underlying
+// resources drops them. Responses carry the ETag the handler set, or else
+// one hashed from the body, and must be revalidated by clients, which get
+// 304 Not Modified while their copy is current. It must run after
+// AuthMiddleware; requests without a company are not cached and a ttl of 0
+// disables it.
+func CacheMiddleware(services *services.Services, ttl time.Duration, tags func(*gin.Context) []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Only cache GET requests
-		if c.Request.Method != "GET" {
+		claim, exists := c.Get("company_id")
+		if ttl <= 0 || services.Cache == nil || c.Request.Method != http.MethodGet || !exists || claim == nil || claim == "" {
 			c.Next()
 			return
 		}
+		ctx := c.Request.Context()
 
-		// Create cache key from URL and query parameters
-		cacheKey := fmt.Sprintf("cache:%s:%s", c.Request.URL.Path, c.Request.URL.RawQuery)
-
-		// Try to get cached response
-		if cached := services.Cache.Get(cacheKey); cached != nil {
-			if cachedResponse, ok := cached.(CachedResponse); ok {
-				// Set cached headers
-				for key, value := range cachedResponse.Headers {
-					c.Header(key, value)
-				}
-				c.Header("X-Cache", "HIT")
-				c.Data(cachedResponse.StatusCode, cachedResponse.ContentType, cachedResponse.Body)
-				c.Abort()
-				return
-			}
-		}
+		// Query parameters are encoded sorted, so their order does not matter
+		cacheKey := fmt.Sprintf("cache:%v:%s?%s", claim, c.Request.URL.Path, c.Request.URL.Query().Encode())
 
-		// Create response writer wrapper to capture response
-		writer := &responseWriter{
-			ResponseWriter: c.Writer,
-			body:           make([]byte, 0),
-			headers:        make(map[string]string),
+		var cached CachedResponse
+		if services.Cache.GetInto(ctx, cacheKey, &cached) {
+			c.Header("X-Cache", "HIT")
+			writeCachedResponse(c, &cached)
+			c.Abort()
+			return
 		}
-		c.Writer = writer
 
+		// Hold the response back so its ETag can be set before it is sent
+		original := c.Writer
+		writer := &bufferedWriter{ResponseWriter: original, status: http.StatusOK}
+		c.Writer = writer
 		c.Next()
+		c.Writer = original
 
-		// Cache successful responses
-		if writer.statusCode >= 200 && writer.statusCode < 300 {
-			cachedResp := CachedResponse{
-				StatusCode:  writer.statusCode,
-				ContentType: writer.Header().Get("Content-Type"),
-				Headers:     writer.headers,
-				Body:        writer.body,
-			}
-			services.Cache.Set(cacheKey, cachedResp, duration)
+		if !writer.written {
+			// Nothing to send; earlier middleware, such as the timeout, responds
+			return
+		}
+		if writer.status != http.StatusOK {
+			original.WriteHeader(writer.status)
+			original.WriteHeaderNow()
+			original.Write(writer.body.Bytes())
+			return
+		}
+
+		body := writer.body.Bytes()
+		etag := original.Header().Get("ETag")
+		if etag == "" {
+			sum := sha256.Sum256(body)
+			etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		}
+		cached = CachedResponse{
+			ContentType: original.Header().Get("Content-Type"),
+			ETag:        etag,
+			Body:        body,
+		}
+		if err := services.Cache.SetTagged(ctx, cacheKey, cached, ttl, tags(c)); err != nil {
+			services.Logger.WarnContext(ctx, "Failed to cache response", "key", cacheKey, "error", err)
 		}
 
 		c.Header("X-Cache", "MISS")
+		writeCachedResponse(c, &cached)
 	}
 }
 
+// CompanyCacheTags tags a cached response with the company in the route
+func CompanyCacheTags(c *gin.Context) []string {
+	return []string{services.CompanyTag(c.Param("companyId"))}
+}
+
+// LocationCacheTags tags a cached response with the location in the route
+func LocationCacheTags(c *gin.Context) []string {
+	return []string{services.LocationTag(c.Param("locationId"))}
+}
+
 // Helper types and functions
 
+// CachedResponse is a successful response stored by CacheMiddleware
 type CachedResponse struct {
-	StatusCode  int               `json:"status_code"`
-	ContentType string            `json:"content_type"`
-	Headers     map[string]string `json:"headers"`
-	Body        []byte            `json:"body"`
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+	Body        []byte `json:"body"`
 }
 
-type responseWriter struct {
-	gin.ResponseWriter
-	body       []byte
-	headers    map[string]string
-	statusCode int
+// writeCachedResponse sends a cached response, or 304 Not Modified when the
+// request's If-None-Match already names its ETag
+func writeCachedResponse(c *gin.Context, cached *CachedResponse) {
+	c.Header("ETag", cached.ETag)
+	c.Header("Cache-Control", "private, no-cache")
+	c.Writer.Header().Add("Vary", "Authorization")
+
+	if etagMatches(c.GetHeader("If-None-Match"), cached.ETag) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.Data(http.StatusOK, cached.ContentType, cached.Body)
 }
 
-func (w *responseWriter) Write(data []byte) (int, error) {
-	w.body = append(w.body, data...)
-	return w.ResponseWriter.Write(data)
+// etagMatches reports whether an If-None-Match header matches etag, using
+// the weak comparison RFC 9110 prescribes for it
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
 }
 
-func (w *responseWriter) WriteHeader(statusCode int) {
-	w.statusCode = statusCode
-	// Capture headers
-	for key, values := range w.Header() {
-		if len(values) > 0 {
-			w.headers[key] = values[0]
-		}
+// bufferedWriter keeps a response in memory instead of sending it, so
+// headers derived from the body can still be set
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body    bytes.Buffer
+	status  int
+	written bool
+}
+
+func (w *bufferedWriter) WriteHeader(statusCode int) {
+	if statusCode > 0 && !w.written {
+		w.status = statusCode
 	}
-	w.ResponseWriter.WriteHeader(statusCode)
 }
 
-func getClientID(c *gin.Context) string {
-	// Try to get user ID from context first
-	if userID, exists := c.Get("user_id"); exists {
-		return fmt.Sprintf("user:%v", userID)
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+// Flush does nothing; a buffered response is sent whole
+func (w *bufferedWriter) Flush() {}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
 	}
+	return w.body.Len()
+}
 
-	// Fallback to IP address
-	clientIP := c.ClientIP()
-	return fmt.Sprintf("ip:%s", clientIP)
+func (w *bufferedWriter) Written() bool {
+	return w.written
 }
\ No newline at end of file
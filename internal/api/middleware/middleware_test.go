@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"marketplace-app/internal/api/handlers"
+	"marketplace-app/internal/config"
+	"marketplace-app/internal/services"
+)
+
+// newTestServices returns services with a memory-only cache and a business
+// service reading a sqlmock database
+func newTestServices(t *testing.T) (*services.Services, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	cfg := &config.Config{RedisURL: "redis://127.0.0.1:1", CacheExpiration: 5, CacheKeyPrefix: "test:"}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cache := services.NewCacheService(cfg, log)
+	t.Cleanup(cache.Close)
+	return &services.Services{
+		Cache:    cache,
+		Business: services.NewBusinessService(db, cfg, nil, cache, log),
+		Logger:   log,
+	}, mock
+}
+
+// newCacheTestRouter serves GET /locations/:locationId through
+// CacheMiddleware, taking the tenant from the X-Company header
+func newCacheTestRouter(svc *services.Services, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if company := c.GetHeader("X-Company"); company != "" {
+			c.Set("company_id", company)
+		}
+	})
+	router.GET("/locations/:locationId", CacheMiddleware(svc, time.Minute, LocationCacheTags), handler)
+	return router
+}
+
+func serve(router *gin.Engine, method, target string, headers map[string]string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestCacheMiddlewareKey(t *testing.T) {
+	svc, _ := newTestServices(t)
+	calls := 0
+	router := newCacheTestRouter(svc, func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"company": c.GetString("company_id")})
+	})
+
+	tenantA := map[string]string{"X-Company": "company-a"}
+	first := serve(router, http.MethodGet, "/locations/loc-1?b=2&a=1", tenantA, "")
+	if first.Header().Get("X-Cache") != "MISS" || calls != 1 {
+		t.Fatalf("got X-Cache %q after %d calls, want a miss", first.Header().Get("X-Cache"), calls)
+	}
+
+	// The query is keyed sorted, so reordering it still hits
+	second := serve(router, http.MethodGet, "/locations/loc-1?a=1&b=2", tenantA, "")
+	if second.Header().Get("X-Cache") != "HIT" || calls != 1 || second.Body.String() != first.Body.String() {
+		t.Errorf("got X-Cache %q after %d calls, want a hit", second.Header().Get("X-Cache"), calls)
+	}
+
+	// Another tenant, or another query, is a different entry
+	other := serve(router, http.MethodGet, "/locations/loc-1?a=1&b=2", map[string]string{"X-Company": "company-b"}, "")
+	if other.Header().Get("X-Cache") != "MISS" || !strings.Contains(other.Body.String(), "company-b") {
+		t.Errorf("got X-Cache %q with body %s, want company-b's own response", other.Header().Get("X-Cache"), other.Body.String())
+	}
+	serve(router, http.MethodGet, "/locations/loc-1?a=2", tenantA, "")
+	if calls != 3 {
+		t.Errorf("got %d handler calls, want 3", calls)
+	}
+
+	// Requests without a tenant are never cached
+	serve(router, http.MethodGet, "/locations/loc-1", nil, "")
+	if noTenant := serve(router, http.MethodGet, "/locations/loc-1", nil, ""); noTenant.Header().Get("X-Cache") != "" || calls != 5 {
+		t.Errorf("got X-Cache %q after %d calls, want requests without a tenant passed through", noTenant.Header().Get("X-Cache"), calls)
+	}
+}
+
+func TestCacheMiddlewareNotModified(t *testing.T) {
+	svc, _ := newTestServices(t)
+	router := newCacheTestRouter(svc, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"location": c.Param("locationId")})
+	})
+	tenant := map[string]string{"X-Company": "company-a"}
+
+	first := serve(router, http.MethodGet, "/locations/loc-1", tenant, "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("got status %d and ETag %q, want 200 with an ETag", first.Code, etag)
+	}
+
+	revalidated := serve(router, http.MethodGet, "/locations/loc-1", map[string]string{"X-Company": "company-a", "If-None-Match": etag}, "")
+	if revalidated.Code != http.StatusNotModified || revalidated.Body.Len() != 0 {
+		t.Errorf("got status %d with %d bytes, want an empty 304", revalidated.Code, revalidated.Body.Len())
+	}
+
+	stale := serve(router, http.MethodGet, "/locations/loc-1", map[string]string{"X-Company": "company-a", "If-None-Match": `"stale"`}, "")
+	if stale.Code != http.StatusOK || stale.Body.String() != first.Body.String() {
+		t.Errorf("got status %d, want the cached 200 for a stale ETag", stale.Code)
+	}
+}
+
+func TestCacheMiddlewareOnlyStoresOK(t *testing.T) {
+	svc, _ := newTestServices(t)
+	status := http.StatusNotFound
+	calls := 0
+	router := newCacheTestRouter(svc, func(c *gin.Context) {
+		calls++
+		c.JSON(status, gin.H{"calls": calls})
+	})
+	tenant := map[string]string{"X-Company": "company-a"}
+
+	if missing := serve(router, http.MethodGet, "/locations/loc-1", tenant, ""); missing.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want the handler's 404", missing.Code)
+	}
+	status = http.StatusOK
+	if found := serve(router, http.MethodGet, "/locations/loc-1", tenant, ""); found.Code != http.StatusOK || calls != 2 {
+		t.Errorf("got status %d after %d calls, want the 404 left uncached", found.Code, calls)
+	}
+}
+
+func TestCacheMiddlewareInvalidatedByUpdate(t *testing.T) {
+	svc, mock := newTestServices(t)
+	business := handlers.NewBusinessHandler(svc)
+	router := newCacheTestRouter(svc, business.GetLocation)
+	router.PATCH("/locations/:locationId", business.UpdateLocation)
+	tenant := map[string]string{"X-Company": "company-a"}
+
+	locationRow := func(version int64) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"location_id", "business_name", "version"}).AddRow("loc-1", "Store", version)
+	}
+	mock.ExpectQuery(`SELECT \* FROM "locations"`).WillReturnRows(locationRow(1))
+
+	if first := serve(router, http.MethodGet, "/locations/loc-1", tenant, ""); first.Header().Get("ETag") != `"v1"` {
+		t.Fatalf("got ETag %q, want the location's version", first.Header().Get("ETag"))
+	}
+	if cached := serve(router, http.MethodGet, "/locations/loc-1", tenant, ""); cached.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("got X-Cache %q, want a hit", cached.Header().Get("X-Cache"))
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "locations"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT \* FROM "locations"`).WillReturnRows(locationRow(2))
+	mock.ExpectCommit()
+	updated := serve(router, http.MethodPatch, "/locations/loc-1", map[string]string{"X-Company": "company-a", "If-Match": `"v1"`}, `{"business_name":"New Store"}`)
+	if updated.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", updated.Code, updated.Body.String())
+	}
+
+	mock.ExpectQuery(`SELECT \* FROM "locations"`).WillReturnRows(locationRow(2))
+	reread := serve(router, http.MethodGet, "/locations/loc-1", tenant, "")
+	if reread.Header().Get("X-Cache") != "MISS" || reread.Header().Get("ETag") != `"v2"` {
+		t.Errorf("got X-Cache %q and ETag %q, want the update to drop the cached response", reread.Header().Get("X-Cache"), reread.Header().Get("ETag"))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
\ No newline at end of file
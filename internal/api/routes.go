@@ -5,6 +5,8 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"marketplace-app/internal/api/handlers"
 	"marketplace-app/internal/api/middleware"
 	"marketplace-app/internal/config"
@@ -17,7 +19,7 @@ func SetupRoutes(router *gin.Engine, services *services.Services, cfg *config.Co
 	setupCORS(router)
 
 	// Setup middleware
-	setupMiddleware(router, services)
+	setupMiddleware(router, services, cfg)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(services, cfg)
@@ -30,6 +32,15 @@ func SetupRoutes(router *gin.Engine, services *services.Services, cfg *config.Co
 
 	// Root-level health endpoint for Railway health checks
 	router.GET("/health", healthHandler.BasicHealth)
+	// Probe endpoints; readiness also fails while the instance drains
+	// during shutdown
+	router.GET("/ready", healthHandler.ReadinessCheck)
+	router.GET("/live", healthHandler.LivenessCheck)
+
+	// Prometheus metrics
+	if cfg.MetricsEnabled {
+		router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	}
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
@@ -37,9 +48,14 @@ func SetupRoutes(router *gin.Engine, services *services.Services, cfg *config.Co
 		// Health and status endpoints
 		v1.GET("/health", healthHandler.BasicHealth)
 		v1.GET("/status", healthHandler.DetailedHealth)
+		v1.GET("/health/database", healthHandler.DatabaseHealth)
+		v1.GET("/health/cache", healthHandler.CacheHealth)
+		v1.GET("/health/scheduler", healthHandler.SchedulerHealth)
+		v1.GET("/health/upstream", healthHandler.UpstreamHealth)
 
 		// Authentication routes
 		auth := v1.Group("/auth")
+		auth.Use(middleware.TimeoutMiddleware(cfg.RouteTimeout("auth")))
 		{
 			// Nango OAuth routes
 			auth.GET("/oauth/callback", authHandler.HandleOAuthCallback)
@@ -52,26 +68,34 @@ func SetupRoutes(router *gin.Engine, services *services.Services, cfg *config.Co
 		}
 
 		// Protected routes (require authentication)
+		// The deadline comes first so it also bounds the plan lookup and
+		// rate limit scripts
 		protected := v1.Group("/")
+		protected.Use(middleware.TimeoutMiddleware(cfg.RouteTimeout("api")))
 		protected.Use(middleware.AuthMiddleware(services))
+		protected.Use(middleware.TenantRateLimitMiddleware(services))
 		{
+			// Cached reads, dropped when the company or location changes
+			cacheCompany := middleware.CacheMiddleware(services, cfg.HTTPCacheTTL, middleware.CompanyCacheTags)
+			cacheLocation := middleware.CacheMiddleware(services, cfg.HTTPCacheTTL, middleware.LocationCacheTags)
+
 			// Company routes
 			companies := protected.Group("/companies")
 			{
-				companies.GET("/:companyId", businessHandler.GetCompany)
-				companies.GET("/:companyId/locations", businessHandler.GetLocations)
+				companies.GET("/:companyId", cacheCompany, businessHandler.GetCompany)
+				companies.GET("/:companyId/locations", cacheCompany, businessHandler.GetLocations)
 				companies.POST("/:companyId/sync", businessHandler.SyncCompanyData)
 			}
 
 			// Location routes
 			locations := protected.Group("/locations")
 			{
-				locations.GET("/:locationId", businessHandler.GetLocation)
-				// TODO: Implement UpdateLocation method
-				// locations.PUT("/:locationId", businessHandler.UpdateLocation)
-				locations.GET("/:locationId/contacts", businessHandler.GetContacts)
+				locations.GET("/:locationId", cacheLocation, businessHandler.GetLocation)
+				locations.PUT("/:locationId", businessHandler.UpdateLocation)
+				locations.PATCH("/:locationId", businessHandler.UpdateLocation)
+				locations.GET("/:locationId/contacts", cacheLocation, businessHandler.GetContacts)
 				locations.POST("/:locationId/contacts", businessHandler.CreateContact)
-				locations.GET("/:locationId/products", businessHandler.GetProducts)
+				locations.GET("/:locationId/products", cacheLocation, businessHandler.GetProducts)
 				locations.POST("/:locationId/products", businessHandler.CreateProduct)
 			}
 
@@ -87,6 +111,7 @@ func SetupRoutes(router *gin.Engine, services *services.Services, cfg *config.Co
 		// Admin routes (require admin authentication)
 		admin := v1.Group("/admin")
 		admin.Use(middleware.AdminMiddleware())
+		admin.Use(middleware.TimeoutMiddleware(cfg.RouteTimeout("admin")))
 		{
 			// TODO: Implement token management endpoints
 			// admin.GET("/tokens/all", tokenHandler.GetAllTokenStatuses)
@@ -95,24 +120,36 @@ func SetupRoutes(router *gin.Engine, services *services.Services, cfg *config.Co
 			admin.GET("/scheduler/stats", adminHandler.GetSchedulerStatus)
 			admin.POST("/scheduler/run-refresh", adminHandler.RefreshAllTokens)
 			admin.POST("/scheduler/run-cleanup", adminHandler.CleanupExpiredTokens)
+			admin.GET("/scheduler/jobs", adminHandler.ListSchedulerJobs)
+			admin.POST("/scheduler/jobs", adminHandler.AddSchedulerJob)
+			admin.GET("/scheduler/jobs/:name", adminHandler.GetSchedulerJob)
+			admin.PUT("/scheduler/jobs/:name", adminHandler.UpdateSchedulerJob)
+			admin.DELETE("/scheduler/jobs/:name", adminHandler.RemoveSchedulerJob)
+			admin.POST("/scheduler/jobs/:name/pause", adminHandler.PauseSchedulerJob)
+			admin.POST("/scheduler/jobs/:name/resume", adminHandler.ResumeSchedulerJob)
+			admin.POST("/scheduler/jobs/:name/run", adminHandler.RunSchedulerJob)
+			admin.GET("/scheduler/runs", adminHandler.GetSchedulerRuns)
+			admin.GET("/scheduler/health", adminHandler.GetSchedulerHealth)
 			admin.GET("/cache/stats", adminHandler.GetCacheStats)
+			admin.GET("/cache/keys", adminHandler.InspectCacheKey)
 			admin.POST("/cache/flush", adminHandler.ClearCache)
 			admin.GET("/system/health", adminHandler.GetSystemHealth)
+			admin.GET("/rate-limit/plans", adminHandler.ListRateLimitPlans)
+			admin.POST("/rate-limit/plans", adminHandler.CreateRateLimitPlan)
+			admin.PUT("/rate-limit/plans/:name", adminHandler.UpdateRateLimitPlan)
+			admin.PUT("/companies/:companyId/rate-limit-plan", adminHandler.AssignRateLimitPlan)
+			admin.GET("/companies/:companyId/usage", adminHandler.GetTenantUsage)
 		}
 	}
 
 	// Webhook routes (for external integrations)
 	webhooks := router.Group("/webhooks")
+	webhooks.Use(middleware.TimeoutMiddleware(cfg.RouteTimeout("webhooks")))
 	{
 		webhooks.POST("/nango/token-refresh", webhookHandler.GenericWebhook)
 		webhooks.POST("/nango/company-update", webhookHandler.GenericWebhook)
 		webhooks.GET("/health", webhookHandler.WebhookHealth)
 	}
-
-	// Start background services
-	if err := services.Start(); err != nil {
-		panic("Failed to start background services: " + err.Error())
-	}
 }
 
 // setupCORS configures Cross-Origin Resource Sharing
@@ -120,8 +157,8 @@ func setupCORS(router *gin.Engine) {
 	config := cors.Config{
 		AllowOrigins:     []string{"*"}, // Configure this properly for production
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "If-Match", "If-None-Match"},
+		ExposeHeaders:    []string{"Content-Length", "ETag", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Quota-Limit", "X-Quota-Remaining", "X-Quota-Reset"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}
@@ -130,14 +167,20 @@ func setupCORS(router *gin.Engine) {
 }
 
 // setupMiddleware configures global middleware
-func setupMiddleware(router *gin.Engine, services *services.Services) {
+func setupMiddleware(router *gin.Engine, services *services.Services, cfg *config.Config) {
 	// Request logging
-	router.Use(gin.Logger())
+	router.Use(middleware.LoggingMiddleware(services.Logger))
+
+	// Request tracing, continuing traces from incoming traceparent headers
+	router.Use(otelgin.Middleware(cfg.ServiceName))
+
+	// Request metrics
+	router.Use(middleware.MetricsMiddleware())
 
 	// Recovery middleware
 	router.Use(gin.Recovery())
 
-	// Rate limiting middleware
+	// Per-IP rate limiting; protected routes are also limited per tenant
 	router.Use(middleware.RateLimitMiddleware(services))
 
 	// Request ID middleware
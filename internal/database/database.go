@@ -2,19 +2,21 @@ package database
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 	"marketplace-app/internal/models"
+	"marketplace-app/internal/telemetry"
 )
 
-// Initialize creates a database connection and runs migrations
-func Initialize(databaseURL string) (*gorm.DB, error) {
+// Initialize creates a database connection and runs migrations. GORM logs
+// through gormLogger.
+func Initialize(databaseURL string, gormLogger logger.Interface) (*gorm.DB, error) {
 	// Configure GORM logger
 	config := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: gormLogger,
 	}
 
 	// Connect to database
@@ -23,6 +25,11 @@ func Initialize(databaseURL string) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	// Trace queries made with a request context
+	if err := telemetry.InstrumentGORM(db); err != nil {
+		return nil, fmt.Errorf("failed to instrument database: %w", err)
+	}
+
 	// Get underlying SQL DB for connection pooling
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -38,18 +45,31 @@ func Initialize(databaseURL string) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	log.Println("Database initialized successfully")
+	slog.Info("Database initialized")
 	return db, nil
 }
 
+// Close closes the database connection pool
+func Close(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+	return sqlDB.Close()
+}
+
 // runMigrations runs all database migrations
 func runMigrations(db *gorm.DB) error {
 	// Enable UUID extension for PostgreSQL
 	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"").Error; err != nil {
-		log.Printf("Warning: Could not create uuid-ossp extension: %v", err)
+		slog.Warn("Could not create uuid-ossp extension", "error", err)
 	}
 
 	// Migrate tables individually in dependency order
+	if err := db.AutoMigrate(&models.RateLimitPlan{}); err != nil {
+		return fmt.Errorf("failed to migrate rate_limit_plans table: %w", err)
+	}
+
 	if err := db.AutoMigrate(&models.Company{}); err != nil {
 		return fmt.Errorf("failed to migrate companies table: %w", err)
 	}
@@ -62,6 +82,18 @@ func runMigrations(db *gorm.DB) error {
 		return fmt.Errorf("failed to migrate token_refreshes table: %w", err)
 	}
 
+	if err := db.AutoMigrate(&models.SchedulerJob{}); err != nil {
+		return fmt.Errorf("failed to migrate scheduler_jobs table: %w", err)
+	}
+
+	if err := db.AutoMigrate(&models.SchedulerJobRun{}); err != nil {
+		return fmt.Errorf("failed to migrate scheduler_job_runs table: %w", err)
+	}
+
+	if err := db.AutoMigrate(&models.DistributedLock{}); err != nil {
+		return fmt.Errorf("failed to migrate distributed_locks table: %w", err)
+	}
+
 	// Now migrate tables with foreign keys
 	if err := db.AutoMigrate(&models.Contact{}); err != nil {
 		return fmt.Errorf("failed to migrate contacts table: %w", err)
@@ -76,7 +108,7 @@ func runMigrations(db *gorm.DB) error {
 		return fmt.Errorf("failed to create indexes: %w", err)
 	}
 
-	log.Println("Database migrations completed successfully")
+	slog.Info("Database migrations completed")
 	return nil
 }
 
@@ -108,5 +140,8 @@ func createIndexes(db *gorm.DB) error {
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_token_refresh_next_refresh ON token_refreshes(next_refresh)")
 	db.Exec("CREATE INDEX IF NOT EXISTS idx_token_refresh_status ON token_refreshes(status)")
 
+	// Scheduler job run indexes
+	db.Exec("CREATE INDEX IF NOT EXISTS idx_scheduler_job_runs_job_started ON scheduler_job_runs(job_name, started_at DESC)")
+
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// GORMLogger writes GORM's logs through slog. Failed queries are logged as
+// errors and queries slower than the threshold as warnings; every statement
+// is logged only at debug level. Statements are logged with placeholders,
+// never with their bound values.
+type GORMLogger struct {
+	logger        *slog.Logger
+	level         gormlogger.LogLevel
+	slowThreshold time.Duration
+}
+
+// NewGORMLogger returns a GORM logger matching the application log level
+func NewGORMLogger(logger *slog.Logger, level string, slowThreshold time.Duration) *GORMLogger {
+	gormLevel := gormlogger.Warn
+	switch ParseLevel(level) {
+	case slog.LevelDebug:
+		gormLevel = gormlogger.Info
+	case slog.LevelError:
+		gormLevel = gormlogger.Error
+	}
+
+	return &GORMLogger{
+		logger:        logger,
+		level:         gormLevel,
+		slowThreshold: slowThreshold,
+	}
+}
+
+func (l *GORMLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	clone := *l
+	clone.level = level
+	return &clone
+}
+
+func (l *GORMLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Info {
+		l.logger.InfoContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *GORMLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		l.logger.WarnContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *GORMLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Error {
+		l.logger.ErrorContext(ctx, fmt.Sprintf(msg, data...))
+	}
+}
+
+func (l *GORMLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && l.level >= gormlogger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		l.logger.ErrorContext(ctx, "Query failed", "error", err, "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	case l.slowThreshold > 0 && elapsed > l.slowThreshold && l.level >= gormlogger.Warn:
+		sql, rows := fc()
+		l.logger.WarnContext(ctx, "Slow query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds(),
+			"threshold_ms", l.slowThreshold.Milliseconds())
+	case l.level >= gormlogger.Info:
+		sql, rows := fc()
+		l.logger.DebugContext(ctx, "Query", "sql", sql, "rows", rows, "duration_ms", elapsed.Milliseconds())
+	}
+}
+
+// ParamsFilter drops bound values so tokens written to the database never
+// reach the logs
+func (l *GORMLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
@@ -0,0 +1,162 @@
+// Package logging builds the application's structured logger. Records carry
+// request-scoped fields from their context and secrets are redacted.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+	"marketplace-app/internal/config"
+	"marketplace-app/internal/telemetry"
+)
+
+// Output formats selectable with LOG_FORMAT
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are never logged
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"authorization": true,
+	"cookie":        true,
+	"api_key":       true,
+	"client_secret": true,
+	"secret_key":    true,
+}
+
+// secretPatterns match credentials embedded in messages and string values:
+// bearer tokens, JWTs and token fields in serialized payloads
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`),
+	regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`),
+	regexp.MustCompile(`(?i)("?(?:access_token|refresh_token|client_secret|secret_key)"?\s*[:=]\s*"?)[^"&,\s}]+`),
+}
+
+// New returns a logger writing to stdout at cfg.LogLevel. Output is JSON in
+// production and text elsewhere unless cfg.LogFormat says otherwise.
+func New(cfg *config.Config) *slog.Logger {
+	return NewWithWriter(cfg, os.Stdout)
+}
+
+// NewWithWriter is New writing to w
+func NewWithWriter(cfg *config.Config, w io.Writer) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level:       ParseLevel(cfg.LogLevel),
+		ReplaceAttr: redactAttr,
+	}
+
+	format := cfg.LogFormat
+	if format == "" {
+		format = FormatText
+		if cfg.Environment == "production" {
+			format = FormatJSON
+		}
+	}
+
+	var handler slog.Handler
+	if format == FormatJSON {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+// ParseLevel converts a LOG_LEVEL value to a slog level, defaulting to info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a context whose log records include the given
+// attributes, in addition to any already on ctx
+func WithFields(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(fieldsKey{}).([]slog.Attr)
+	fields := make([]slog.Attr, 0, len(existing)+len(attrs))
+	fields = append(fields, existing...)
+	fields = append(fields, attrs...)
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// Redact masks credentials found in s
+func Redact(s string) string {
+	for _, pattern := range secretPatterns {
+		if pattern.NumSubexp() > 0 {
+			s = pattern.ReplaceAllString(s, "${1}"+redacted)
+		} else {
+			s = pattern.ReplaceAllString(s, redacted)
+		}
+	}
+	return s
+}
+
+// contextHandler adds the request ID, trace IDs and fields stored with
+// WithFields to every record logged with a context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if requestID := telemetry.RequestID(ctx); requestID != "" {
+			record.AddAttrs(slog.String("request_id", requestID))
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			record.AddAttrs(
+				slog.String("trace_id", spanContext.TraceID().String()),
+				slog.String("span_id", spanContext.SpanID().String()),
+			)
+		}
+		if fields, ok := ctx.Value(fieldsKey{}).([]slog.Attr); ok {
+			record.AddAttrs(fields...)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// redactAttr masks sensitive attributes: keys naming a credential, any key
+// ending in "token" or "secret", and credentials inside string values
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	if sensitiveKeys[key] || strings.HasSuffix(key, "token") || strings.HasSuffix(key, "secret") {
+		return slog.String(attr.Key, redacted)
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, Redact(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, Redact(err.Error()))
+		}
+	}
+	return attr
+}
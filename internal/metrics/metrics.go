@@ -0,0 +1,185 @@
+// Package metrics defines the Prometheus metrics exported on /metrics
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "marketplace"
+
+// Token refresh outcomes
+const (
+	RefreshSucceeded      = "success"
+	RefreshFailed         = "failure"
+	RefreshReauthRequired = "reauth_required"
+	// RefreshSkipped counts refreshes another instance completed first
+	RefreshSkipped = "skipped"
+)
+
+// Cache lookup results
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// Cache load outcomes
+const (
+	LoadSucceeded = "success"
+	LoadFailed    = "failure"
+)
+
+var (
+	// HTTPRequestsTotal counts handled requests by route template and status
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes request latency by route template and status
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// UpstreamRequestDuration observes each attempt of a provider call,
+	// including retries; status is "error" when no response was received
+	UpstreamRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Provider API call latency per attempt, by provider, endpoint and status.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"provider", "endpoint", "status"})
+
+	// UpstreamErrorsTotal counts failed provider calls; reason is the
+	// response status code, "network" or "circuit_open"
+	UpstreamErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Failed provider API calls, by provider, endpoint and reason.",
+	}, []string{"provider", "endpoint", "reason"})
+
+	// TokenRefreshesTotal counts token refreshes by outcome
+	TokenRefreshesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "OAuth token refreshes, by provider and outcome.",
+	}, []string{"provider", "outcome"})
+
+	// SchedulerJobDuration observes scheduler job runs by job and run status
+	SchedulerJobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scheduler_job_duration_seconds",
+		Help:      "Scheduler job run duration, by job and run status.",
+		Buckets:   []float64{.1, .5, 1, 5, 15, 30, 60, 120, 300, 600},
+	}, []string{"job", "status"})
+
+	// CacheRequestsTotal counts cache lookups by tier, result and key prefix,
+	// the part of the key before the first colon
+	CacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups, by tier (l1, redis or memory), result (hit or miss) and key prefix.",
+	}, []string{"tier", "result", "prefix"})
+
+	// CacheEvictionsTotal counts entries an in-process tier dropped on its
+	// own, to make room or on expiry, rather than by invalidation
+	CacheEvictionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_evictions_total",
+		Help:      "Cache entries evicted from an in-process tier (l1 or memory), by key prefix.",
+	}, []string{"tier", "prefix"})
+
+	// CacheOperationDuration observes cache reads and writes across tiers
+	CacheOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cache_operation_duration_seconds",
+		Help:      "Cache operation latency, by operation (get, set or delete).",
+		Buckets:   []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+	}, []string{"operation"})
+
+	// RateLimitRejectionsTotal counts requests refused with 429; scope is
+	// "ip", "tenant" or "quota" for a tenant's daily quota
+	RateLimitRejectionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the rate limiter, by scope (ip, tenant or quota).",
+	}, []string{"scope"})
+
+	// CacheLoadsTotal counts loader runs behind GetOrLoad; reason is "miss",
+	// "stale" for stale-while-revalidate or "early" for early expiration
+	CacheLoadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_loads_total",
+		Help:      "Cache loader runs, by reason (miss, stale or early) and outcome.",
+	}, []string{"reason", "outcome"})
+)
+
+// RegisterDBStats exports connection pool gauges for the database
+func RegisterDBStats(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+}
+
+// EntityCounter returns the number of stored rows per business entity
+type EntityCounter func(ctx context.Context) (map[string]int64, error)
+
+// RegisterBusinessCollector exports business entity counts. Counts are
+// queried at most once per ttl so frequent scrapes do not load the database.
+func RegisterBusinessCollector(count EntityCounter, ttl time.Duration) {
+	prometheus.MustRegister(&businessCollector{
+		count: count,
+		ttl:   ttl,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "business", "entities"),
+			"Stored business entities, by entity type.",
+			[]string{"entity"}, nil,
+		),
+	})
+}
+
+// businessCollector caches entity counts between scrapes
+type businessCollector struct {
+	count EntityCounter
+	ttl   time.Duration
+	desc  *prometheus.Desc
+
+	mu        sync.Mutex
+	counts    map[string]int64
+	countedAt time.Time
+}
+
+func (bc *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bc.desc
+}
+
+func (bc *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.counts == nil || time.Since(bc.countedAt) > bc.ttl {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		counts, err := bc.count(ctx)
+		cancel()
+		if err != nil {
+			// Keep exporting the last known counts
+			slog.Error("Failed to count business entities for metrics", "error", err)
+		} else {
+			bc.counts = counts
+			bc.countedAt = time.Now()
+		}
+	}
+
+	for entity, count := range bc.counts {
+		ch <- prometheus.MustNewConstMetric(bc.desc, prometheus.GaugeValue, float64(count), entity)
+	}
+}
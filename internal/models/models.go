@@ -1,6 +1,9 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +18,9 @@ type Company struct {
 	AccessToken string    `gorm:"not null" json:"-"` // Hidden from JSON
 	RefreshToken string   `gorm:"not null" json:"-"` // Hidden from JSON
 	TokenExpiry time.Time `json:"token_expiry"`
+	TokenIssuedAt time.Time `json:"token_issued_at"`
+	Provider    string    `gorm:"not null;default:gohighlevel" json:"provider"` // OAuth provider that issued the token
+	RateLimitPlanID *uuid.UUID `gorm:"type:uuid;index" json:"rate_limit_plan_id,omitempty"` // nil for the default plan
 	IsActive    bool      `gorm:"default:true" json:"is_active"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -41,6 +47,8 @@ type Location struct {
 	Email            string    `json:"email"`
 	Website          string    `json:"website"`
 	IsActive         bool      `gorm:"default:true" json:"is_active"`
+	// Version is incremented by every update, for optimistic concurrency
+	Version          int64     `gorm:"not null;default:1" json:"version"`
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
 	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
@@ -89,6 +97,22 @@ type Product struct {
 	Location Location `gorm:"-" json:"location,omitempty"`
 }
 
+// RateLimitPlan is a set of API limits assignable to companies. Requests
+// are limited to RequestsPerSecond on average over the rate limit window and
+// to Burst in any one second; DailyQuota caps requests per UTC day. A Burst
+// or DailyQuota of 0 means no limit. The plan named "default" applies to
+// companies without one.
+type RateLimitPlan struct {
+	ID                uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name              string    `gorm:"uniqueIndex;not null" json:"name"`
+	Description       string    `json:"description"`
+	RequestsPerSecond float64   `gorm:"not null" json:"requests_per_second"`
+	Burst             int       `gorm:"not null;default:0" json:"burst"`
+	DailyQuota        int64     `gorm:"not null;default:0" json:"daily_quota"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
 // TokenRefresh represents token refresh tracking
 type TokenRefresh struct {
 	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
@@ -103,4 +127,79 @@ type TokenRefresh struct {
 
 	// Relationships (loaded separately to avoid circular dependencies during migration)
 	Company Company `gorm:"-" json:"company,omitempty"`
-}
\ No newline at end of file
+}
+
+// SchedulerJob represents a persisted scheduled job definition
+type SchedulerJob struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name       string    `gorm:"uniqueIndex;not null" json:"name"`
+	Spec       string    `gorm:"not null" json:"spec"`     // cron expression with seconds
+	JobType    string    `gorm:"not null" json:"job_type"` // token_refresh, token_cleanup, health_check, token_monitor
+	Enabled    bool      `gorm:"not null" json:"enabled"`
+	Parameters JSONMap   `gorm:"type:jsonb" json:"parameters,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// Deleted jobs keep their row, so a deleted built-in job is not seeded again
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// SchedulerJobRun records a single execution of a scheduler job
+type SchedulerJobRun struct {
+	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	JobName        string    `gorm:"not null;index" json:"job_name"`
+	JobType        string    `json:"job_type"`
+	Trigger        string    `json:"trigger"` // scheduled, manual
+	InstanceID     string    `json:"instance_id"`
+	StartedAt      time.Time `gorm:"not null;index" json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+	DurationMs     int64     `json:"duration_ms"`
+	Status         string    `gorm:"not null;index" json:"status"` // succeeded, failed, skipped
+	ErrorMessage   string    `json:"error_message,omitempty"`
+	ItemsProcessed int       `json:"items_processed"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// DistributedLock is a lease on a named lock, taken in Postgres whenever a
+// database is configured. An expired row is free to be claimed again.
+type DistributedLock struct {
+	Name       string    `gorm:"primaryKey" json:"name"`
+	Holder     string    `gorm:"not null" json:"holder"`
+	Token      string    `gorm:"not null" json:"-"`
+	AcquiredAt time.Time `gorm:"not null" json:"acquired_at"`
+	ExpiresAt  time.Time `gorm:"not null" json:"expires_at"`
+}
+
+// JSONMap is a free-form JSON object stored in a jsonb column
+type JSONMap map[string]interface{}
+
+// Value implements driver.Valuer
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (m *JSONMap) Scan(value interface{}) error {
+	if value == nil {
+		*m = nil
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONMap", value)
+	}
+
+	return json.Unmarshal(data, m)
+}
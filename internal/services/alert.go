@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"marketplace-app/internal/config"
+)
+
+// Alert severities, in increasing order of urgency
+const (
+	AlertSeverityInfo     = "info"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+)
+
+// Alert statuses
+const (
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+)
+
+// alertQueueSize bounds the number of notifications waiting to be delivered
+const alertQueueSize = 256
+
+// activeAlertTTL bounds how long an unresolved alert is remembered
+const activeAlertTTL = 7 * 24 * time.Hour
+
+// Alert is a notification about a condition that needs attention
+type Alert struct {
+	Key       string            `json:"key"`
+	Severity  string            `json:"severity"`
+	Status    string            `json:"status"`
+	Title     string            `json:"title"`
+	Message   string            `json:"message"`
+	CompanyID string            `json:"company_id,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// Notifier delivers alerts to an external channel
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// notifierRoute sends alerts of the listed severities to a notifier
+type notifierRoute struct {
+	notifier   Notifier
+	severities map[string]bool
+}
+
+// AlertService routes alerts to notifiers by severity. Firing alerts are
+// deduplicated per key within a window, and a resolved notification is sent
+// when a previously firing alert clears. Dedup state lives in the cache so
+// replicas share it.
+type AlertService struct {
+	cache       *CacheService
+	routes      []notifierRoute
+	dedupWindow time.Duration
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan Alert
+	wg     sync.WaitGroup
+
+	logger *slog.Logger
+}
+
+func NewAlertService(cfg *config.Config, cache *CacheService, logger *slog.Logger) *AlertService {
+	as := &AlertService{
+		cache:       cache,
+		dedupWindow: cfg.AlertDedupWindow,
+		logger:      logger,
+		queue:       make(chan Alert, alertQueueSize),
+	}
+
+	if cfg.AlertWebhookURL != "" {
+		as.AddNotifier(NewWebhookNotifier(cfg.AlertWebhookURL), cfg.AlertWebhookSeverities...)
+	}
+	if cfg.AlertSlackWebhookURL != "" {
+		as.AddNotifier(NewSlackNotifier(cfg.AlertSlackWebhookURL), cfg.AlertSlackSeverities...)
+	}
+	if cfg.AlertSMTPHost != "" && len(cfg.AlertEmailTo) > 0 {
+		as.AddNotifier(NewEmailNotifier(cfg), cfg.AlertEmailSeverities...)
+	}
+
+	as.wg.Add(1)
+	go as.deliver()
+
+	return as
+}
+
+// AddNotifier routes alerts of the given severities to a notifier
+func (as *AlertService) AddNotifier(notifier Notifier, severities ...string) {
+	route := notifierRoute{notifier: notifier, severities: make(map[string]bool)}
+	for _, severity := range severities {
+		route.severities[severity] = true
+	}
+	as.routes = append(as.routes, route)
+}
+
+// Fire raises an alert. Repeats of the same key and severity within the
+// dedup window are dropped; an escalation in severity is always sent.
+func (as *AlertService) Fire(ctx context.Context, alert Alert) {
+	alert.Status = AlertStatusFiring
+	if alert.Timestamp.IsZero() {
+		alert.Timestamp = time.Now()
+	}
+
+	// Remember the alert as active so a later Resolve knows to notify
+	as.cache.Set(ctx, activeAlertKey(alert.Key), alert.Severity, activeAlertTTL)
+
+	sentKey := fmt.Sprintf("alert_sent:%s:%s", alert.Key, alert.Severity)
+	first, err := as.cache.SetNX(ctx, sentKey, alert.Timestamp.Unix(), as.dedupWindow)
+	if err != nil {
+		as.logger.WarnContext(ctx, "Alert dedup check failed", "alert", alert.Key, "error", err)
+	}
+	if err == nil && !first {
+		return
+	}
+
+	as.enqueue(alert)
+}
+
+// Resolve clears an alert and sends a resolved notification if it was firing
+func (as *AlertService) Resolve(ctx context.Context, key, title, message string) {
+	severity, ok := GetJSON[string](ctx, as.cache, activeAlertKey(key))
+	if !ok {
+		return
+	}
+
+	// Only the caller that removes the active alert notifies, so replicas
+	// resolving it at the same time send a single notification
+	removed, err := as.cache.Remove(ctx, activeAlertKey(key))
+	if err != nil {
+		as.logger.WarnContext(ctx, "Failed to clear active alert", "key", key, "error", err)
+		return
+	}
+	if !removed {
+		return
+	}
+	for _, s := range []string{AlertSeverityInfo, AlertSeverityWarning, AlertSeverityCritical} {
+		as.cache.Delete(ctx, fmt.Sprintf("alert_sent:%s:%s", key, s))
+	}
+
+	as.enqueue(Alert{
+		Key:       key,
+		Severity:  severity,
+		Status:    AlertStatusResolved,
+		Title:     title,
+		Message:   message,
+		Timestamp: time.Now(),
+	})
+}
+
+// Close stops accepting alerts and waits for queued notifications to be
+// delivered, giving up on the remainder when ctx ends
+func (as *AlertService) Close(ctx context.Context) {
+	as.mu.Lock()
+	if as.closed {
+		as.mu.Unlock()
+		return
+	}
+	as.closed = true
+	close(as.queue)
+	as.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		as.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		as.logger.WarnContext(ctx, "Timeout flushing alerts", "undelivered", len(as.queue))
+	}
+}
+
+// Private helper methods
+
+func (as *AlertService) enqueue(alert Alert) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if as.closed {
+		as.logger.Warn("Alert service closed, dropping alert", "alert", alert.Key, "status", alert.Status)
+		return
+	}
+
+	select {
+	case as.queue <- alert:
+	default:
+		as.logger.Warn("Alert queue full, dropping alert", "alert", alert.Key, "status", alert.Status)
+	}
+}
+
+func (as *AlertService) deliver() {
+	defer as.wg.Done()
+
+	for alert := range as.queue {
+		as.logger.Log(context.Background(), alertLogLevel(alert), alert.Title,
+			"alert", alert.Key, "severity", alert.Severity, "status", alert.Status, "message", alert.Message)
+
+		for _, route := range as.routes {
+			if !route.severities[alert.Severity] {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			if err := route.notifier.Notify(ctx, alert); err != nil {
+				as.logger.Error("Failed to send alert", "alert", alert.Key, "notifier", route.notifier.Name(), "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// alertLogLevel logs firing alerts at a level matching their severity and
+// resolutions at info
+func alertLogLevel(alert Alert) slog.Level {
+	if alert.Status == AlertStatusResolved {
+		return slog.LevelInfo
+	}
+	switch alert.Severity {
+	case AlertSeverityCritical:
+		return slog.LevelError
+	case AlertSeverityWarning:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+func activeAlertKey(key string) string {
+	return fmt.Sprintf("alert_active:%s", key)
+}
+
+// TokenExpiryAlertKey is the dedup key for a company's token expiry alerts
+func TokenExpiryAlertKey(companyID string) string {
+	return fmt.Sprintf("token_expiry:%s", companyID)
+}
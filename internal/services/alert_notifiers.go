@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"marketplace-app/internal/config"
+)
+
+// WebhookNotifier posts alerts as JSON to a generic HTTP endpoint
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the notifier name used in logs
+func (wn *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// Notify sends the alert payload to the webhook URL
+func (wn *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, wn.client, wn.url, alert)
+}
+
+// SlackNotifier posts alerts to a Slack-compatible incoming webhook
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name returns the notifier name used in logs
+func (sn *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// Notify formats the alert as a Slack message attachment
+func (sn *SlackNotifier) Notify(ctx context.Context, alert Alert) error {
+	color := "warning"
+	switch {
+	case alert.Status == AlertStatusResolved:
+		color = "good"
+	case alert.Severity == AlertSeverityCritical:
+		color = "danger"
+	}
+
+	fields := []map[string]interface{}{
+		{"title": "Severity", "value": alert.Severity, "short": true},
+		{"title": "Status", "value": alert.Status, "short": true},
+	}
+	if alert.CompanyID != "" {
+		fields = append(fields, map[string]interface{}{"title": "Company", "value": alert.CompanyID, "short": true})
+	}
+
+	payload := map[string]interface{}{
+		"text": alertSubject(alert),
+		"attachments": []map[string]interface{}{
+			{
+				"color":  color,
+				"text":   alert.Message,
+				"fields": fields,
+				"ts":     alert.Timestamp.Unix(),
+			},
+		},
+	}
+
+	return postJSON(ctx, sn.client, sn.url, payload)
+}
+
+// EmailNotifier sends alerts by SMTP
+type EmailNotifier struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func NewEmailNotifier(cfg *config.Config) *EmailNotifier {
+	return &EmailNotifier{
+		addr:     fmt.Sprintf("%s:%d", cfg.AlertSMTPHost, cfg.AlertSMTPPort),
+		host:     cfg.AlertSMTPHost,
+		username: cfg.AlertSMTPUsername,
+		password: cfg.AlertSMTPPassword,
+		from:     cfg.AlertEmailFrom,
+		to:       cfg.AlertEmailTo,
+	}
+}
+
+// Name returns the notifier name used in logs
+func (en *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Notify sends the alert as a plain-text email
+func (en *EmailNotifier) Notify(ctx context.Context, alert Alert) error {
+	var auth smtp.Auth
+	if en.username != "" {
+		auth = smtp.PlainAuth("", en.username, en.password, en.host)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", en.from)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(en.to, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", alertSubject(alert))
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&body, "%s\r\n\r\n", alert.Message)
+	fmt.Fprintf(&body, "Severity: %s\r\nStatus: %s\r\n", alert.Severity, alert.Status)
+	if alert.CompanyID != "" {
+		fmt.Fprintf(&body, "Company: %s\r\n", alert.CompanyID)
+	}
+	fmt.Fprintf(&body, "Time: %s\r\n", alert.Timestamp.Format(time.RFC3339))
+
+	// net/smtp has no context support, so honor cancellation around the call
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(en.addr, auth, en.from, en.to, []byte(body.String()))
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Helper functions
+
+func alertSubject(alert Alert) string {
+	if alert.Status == AlertStatusResolved {
+		return fmt.Sprintf("[RESOLVED] %s", alert.Title)
+	}
+	return fmt.Sprintf("[%s] %s", strings.ToUpper(alert.Severity), alert.Title)
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, payload interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
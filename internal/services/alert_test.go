@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"marketplace-app/internal/config"
+)
+
+// recordingNotifier remembers the alerts it was sent
+type recordingNotifier struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (n *recordingNotifier) Name() string { return "recording" }
+
+func (n *recordingNotifier) Notify(ctx context.Context, alert Alert) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+// sent lists the alerts delivered as "status severity"
+func (n *recordingNotifier) sent() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	sent := make([]string, len(n.alerts))
+	for i, alert := range n.alerts {
+		sent[i] = alert.Status + " " + alert.Severity
+	}
+	return sent
+}
+
+func TestAlertDedupEscalationAndResolve(t *testing.T) {
+	for name, cache := range newTestCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			as := NewAlertService(&config.Config{AlertDedupWindow: time.Minute}, cache, testLogger)
+			pager, chat := &recordingNotifier{}, &recordingNotifier{}
+			as.AddNotifier(pager, AlertSeverityCritical)
+			as.AddNotifier(chat, AlertSeverityWarning, AlertSeverityCritical)
+
+			// Resolving an alert that never fired sends nothing
+			as.Resolve(ctx, "token_expiry:"+name, "Token healthy", "")
+
+			warning := Alert{Key: "token_expiry:" + name, Severity: AlertSeverityWarning, Title: "Token expiring"}
+			as.Fire(ctx, warning)
+			as.Fire(ctx, warning)
+			critical := warning
+			critical.Severity = AlertSeverityCritical
+			as.Fire(ctx, critical)
+
+			// Replicas resolving together send one notification
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					as.Resolve(ctx, warning.Key, "Token healthy", "")
+				}()
+			}
+			wg.Wait()
+			as.Resolve(ctx, warning.Key, "Token healthy", "")
+
+			// A resolved alert fires again without waiting out the window
+			as.Fire(ctx, warning)
+			as.Close(ctx)
+
+			assertSent(t, "pager", pager.sent(), []string{"firing critical", "resolved critical"})
+			assertSent(t, "chat", chat.sent(), []string{"firing warning", "firing critical", "resolved critical", "firing warning"})
+		})
+	}
+}
+
+func assertSent(t *testing.T, notifier string, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s got %v, want %v", notifier, got, want)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s got %v, want %v", notifier, got, want)
+			return
+		}
+	}
+}
\ No newline at end of file
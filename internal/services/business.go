@@ -1,255 +1,496 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
+	"marketplace-app/internal/config"
 	"marketplace-app/internal/models"
 )
 
+var (
+	// ErrLocationNotFound is returned when updating a location that does not
+	// exist or is inactive
+	ErrLocationNotFound = errors.New("location not found")
+	// ErrInvalidLocation is returned when a location update fails validation
+	ErrInvalidLocation = errors.New("invalid location")
+	// ErrLocationVersionMismatch is returned when a location has changed
+	// since the version an update was based on
+	ErrLocationVersionMismatch = errors.New("location version mismatch")
+)
+
+// maxLocationFieldLength bounds every editable location field
+const maxLocationFieldLength = 255
+
 type BusinessService struct {
-	db    *gorm.DB
-	nango *NangoService
-	cache *CacheService
+	db     *gorm.DB
+	config *config.Config
+	nango  *NangoService
+	cache  *CacheService
+
+	// background work such as location syncs outlives the request that
+	// started it; Stop waits for it and then cancels background
+	background     context.Context
+	stopBackground context.CancelFunc
+	workers        sync.WaitGroup
+
+	logger *slog.Logger
 }
 
-func NewBusinessService(db *gorm.DB, nango *NangoService, cache *CacheService) *BusinessService {
+func NewBusinessService(db *gorm.DB, cfg *config.Config, nango *NangoService, cache *CacheService, logger *slog.Logger) *BusinessService {
+	background, stopBackground := context.WithCancel(context.Background())
 	return &BusinessService{
-		db:    db,
-		nango: nango,
-		cache: cache,
+		db:             db,
+		config:         cfg,
+		nango:          nango,
+		cache:          cache,
+		background:     background,
+		stopBackground: stopBackground,
+		logger:         logger,
 	}
 }
 
 // GetCompanyByID retrieves a company by its ID
-func (bs *BusinessService) GetCompanyByID(companyID string) (*models.Company, error) {
-	// Check cache first
+func (bs *BusinessService) GetCompanyByID(ctx context.Context, companyID string) (*models.Company, error) {
 	cacheKey := fmt.Sprintf("company:%s", companyID)
-	if cached := bs.cache.Get(cacheKey); cached != nil {
-		if company, ok := cached.(*models.Company); ok {
-			return company, nil
+	tags := []string{CompanyTag(companyID)}
+	return GetOrLoad(ctx, bs.cache, cacheKey, 30*time.Minute, tags, func(ctx context.Context) (*models.Company, error) {
+		company := &models.Company{}
+		err := bs.db.WithContext(ctx).Where("company_id = ? AND is_active = ?", companyID, true).First(company).Error
+		if err != nil {
+			return nil, fmt.Errorf("company not found: %w", err)
 		}
-	}
-
-	company := &models.Company{}
-	err := bs.db.Where("company_id = ? AND is_active = ?", companyID, true).First(company).Error
-	if err != nil {
-		return nil, fmt.Errorf("company not found: %w", err)
-	}
-
-	// Cache the result
-	bs.cache.Set(cacheKey, company, 30*time.Minute)
-	return company, nil
+		return company, nil
+	})
 }
 
 // GetLocationsByCompany retrieves all locations for a company
-func (bs *BusinessService) GetLocationsByCompany(companyID string) ([]models.Location, error) {
-	// Check cache first
+func (bs *BusinessService) GetLocationsByCompany(ctx context.Context, companyID string) ([]models.Location, error) {
 	cacheKey := fmt.Sprintf("locations:%s", companyID)
-	if cached := bs.cache.Get(cacheKey); cached != nil {
-		if locations, ok := cached.([]models.Location); ok {
-			return locations, nil
+	tags := []string{CompanyTag(companyID)}
+	return GetOrLoad(ctx, bs.cache, cacheKey, 15*time.Minute, tags, func(ctx context.Context) ([]models.Location, error) {
+		company, err := bs.GetCompanyByID(ctx, companyID)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	company, err := bs.GetCompanyByID(companyID)
-	if err != nil {
-		return nil, err
-	}
-
-	var locations []models.Location
-	err = bs.db.Where("company_id = ? AND is_active = ?", company.ID, true).Find(&locations).Error
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch locations: %w", err)
-	}
-
-	// If no locations in DB, fetch from Nango
-	if len(locations) == 0 {
-		locations, err = bs.nango.GetLocations(companyID)
+		var locations []models.Location
+		err = bs.db.WithContext(ctx).Where("company_id = ? AND is_active = ?", company.ID, true).Find(&locations).Error
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch locations from Nango: %w", err)
+			return nil, fmt.Errorf("failed to fetch locations: %w", err)
 		}
-	}
 
-	// Cache the result
-	bs.cache.Set(cacheKey, locations, 15*time.Minute)
-	return locations, nil
+		// If no locations in DB, fetch from Nango
+		if len(locations) == 0 {
+			locations, err = bs.nango.GetLocations(ctx, companyID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch locations from Nango: %w", err)
+			}
+		}
+		return locations, nil
+	})
 }
 
 // GetLocationByID retrieves a specific location
-func (bs *BusinessService) GetLocationByID(locationID string) (*models.Location, error) {
-	// Check cache first
+func (bs *BusinessService) GetLocationByID(ctx context.Context, locationID string) (*models.Location, error) {
 	cacheKey := fmt.Sprintf("location:%s", locationID)
-	if cached := bs.cache.Get(cacheKey); cached != nil {
-		if location, ok := cached.(*models.Location); ok {
-			return location, nil
+	tags := []string{LocationTag(locationID)}
+	return GetOrLoad(ctx, bs.cache, cacheKey, 30*time.Minute, tags, func(ctx context.Context) (*models.Location, error) {
+		location := &models.Location{}
+		err := bs.db.WithContext(ctx).Where("location_id = ? AND is_active = ?", locationID, true).First(location).Error
+		if err != nil {
+			return nil, fmt.Errorf("location not found: %w", err)
 		}
-	}
-
-	location := &models.Location{}
-	err := bs.db.Where("location_id = ? AND is_active = ?", locationID, true).First(location).Error
-	if err != nil {
-		return nil, fmt.Errorf("location not found: %w", err)
-	}
-
-	// Cache the result
-	bs.cache.Set(cacheKey, location, 30*time.Minute)
-	return location, nil
+		return location, nil
+	})
 }
 
 // GetContactsByLocation retrieves all contacts for a location
-func (bs *BusinessService) GetContactsByLocation(locationID string) ([]models.Contact, error) {
-	// Check cache first
+func (bs *BusinessService) GetContactsByLocation(ctx context.Context, locationID string) ([]models.Contact, error) {
 	cacheKey := fmt.Sprintf("contacts:%s", locationID)
-	if cached := bs.cache.Get(cacheKey); cached != nil {
-		if contacts, ok := cached.([]models.Contact); ok {
-			return contacts, nil
+	tags := []string{LocationTag(locationID)}
+	return GetOrLoad(ctx, bs.cache, cacheKey, 15*time.Minute, tags, func(ctx context.Context) ([]models.Contact, error) {
+		location, err := bs.GetLocationByID(ctx, locationID)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	location, err := bs.GetLocationByID(locationID)
-	if err != nil {
-		return nil, err
-	}
 
-	var contacts []models.Contact
-	err = bs.db.Where("location_id = ?", location.ID).Find(&contacts).Error
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch contacts: %w", err)
-	}
-
-	// If no contacts in DB, fetch from external API and save
-	if len(contacts) == 0 {
-		contacts, err = bs.fetchAndSaveContacts(location)
+		var contacts []models.Contact
+		err = bs.db.WithContext(ctx).Where("location_id = ?", location.ID).Find(&contacts).Error
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch contacts from API: %w", err)
+			return nil, fmt.Errorf("failed to fetch contacts: %w", err)
 		}
-	}
 
-	// Cache the result
-	bs.cache.Set(cacheKey, contacts, 15*time.Minute)
-	return contacts, nil
+		// If no contacts in DB, fetch from external API and save
+		if len(contacts) == 0 {
+			contacts, err = bs.fetchAndSaveContacts(ctx, location)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch contacts from API: %w", err)
+			}
+		}
+		return contacts, nil
+	})
 }
 
 // GetProductsByLocation retrieves all products for a location
-func (bs *BusinessService) GetProductsByLocation(locationID string) ([]models.Product, error) {
-	// Check cache first
+func (bs *BusinessService) GetProductsByLocation(ctx context.Context, locationID string) ([]models.Product, error) {
 	cacheKey := fmt.Sprintf("products:%s", locationID)
-	if cached := bs.cache.Get(cacheKey); cached != nil {
-		if products, ok := cached.([]models.Product); ok {
-			return products, nil
+	tags := []string{LocationTag(locationID)}
+	return GetOrLoad(ctx, bs.cache, cacheKey, 15*time.Minute, tags, func(ctx context.Context) ([]models.Product, error) {
+		location, err := bs.GetLocationByID(ctx, locationID)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	location, err := bs.GetLocationByID(locationID)
-	if err != nil {
-		return nil, err
-	}
-
-	var products []models.Product
-	err = bs.db.Where("location_id = ? AND is_active = ?", location.ID, true).Find(&products).Error
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch products: %w", err)
-	}
 
-	// If no products in DB, fetch from external API and save
-	if len(products) == 0 {
-		products, err = bs.fetchAndSaveProducts(location)
+		var products []models.Product
+		err = bs.db.WithContext(ctx).Where("location_id = ? AND is_active = ?", location.ID, true).Find(&products).Error
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch products from API: %w", err)
+			return nil, fmt.Errorf("failed to fetch products: %w", err)
 		}
-	}
 
-	// Cache the result
-	bs.cache.Set(cacheKey, products, 15*time.Minute)
-	return products, nil
+		// If no products in DB, fetch from external API and save
+		if len(products) == 0 {
+			products, err = bs.fetchAndSaveProducts(ctx, location)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch products from API: %w", err)
+			}
+		}
+		return products, nil
+	})
 }
 
 // CreateContact creates a new contact for a location
-func (bs *BusinessService) CreateContact(locationID string, contact *models.Contact) error {
-	location, err := bs.GetLocationByID(locationID)
+func (bs *BusinessService) CreateContact(ctx context.Context, locationID string, contact *models.Contact) error {
+	location, err := bs.GetLocationByID(ctx, locationID)
 	if err != nil {
 		return err
 	}
 
 	contact.LocationID = location.ID
 
-	if err := bs.db.Create(contact).Error; err != nil {
+	if err := bs.db.WithContext(ctx).Create(contact).Error; err != nil {
 		return fmt.Errorf("failed to create contact: %w", err)
 	}
 
-	// Invalidate cache
-	cacheKey := fmt.Sprintf("contacts:%s", locationID)
-	bs.cache.Delete(cacheKey)
+	// Invalidate the cached contacts and responses listing them
+	if err := bs.cache.InvalidateTags(ctx, LocationTag(locationID)); err != nil {
+		bs.logger.WarnContext(ctx, "Failed to invalidate cached contacts", "location_id", locationID, "error", err)
+	}
 
 	return nil
 }
 
 // CreateProduct creates a new product for a location
-func (bs *BusinessService) CreateProduct(locationID string, product *models.Product) error {
-	location, err := bs.GetLocationByID(locationID)
+func (bs *BusinessService) CreateProduct(ctx context.Context, locationID string, product *models.Product) error {
+	location, err := bs.GetLocationByID(ctx, locationID)
 	if err != nil {
 		return err
 	}
 
 	product.LocationID = location.ID
 
-	if err := bs.db.Create(product).Error; err != nil {
+	if err := bs.db.WithContext(ctx).Create(product).Error; err != nil {
 		return fmt.Errorf("failed to create product: %w", err)
 	}
 
-	// Invalidate cache
-	cacheKey := fmt.Sprintf("products:%s", locationID)
-	bs.cache.Delete(cacheKey)
+	// Invalidate the cached products and responses listing them
+	if err := bs.cache.InvalidateTags(ctx, LocationTag(locationID)); err != nil {
+		bs.logger.WarnContext(ctx, "Failed to invalidate cached products", "location_id", locationID, "error", err)
+	}
 
 	return nil
 }
 
-// UpdateLocation updates location information
-func (bs *BusinessService) UpdateLocation(locationID string, updates map[string]interface{}) error {
-	location, err := bs.GetLocationByID(locationID)
+// LocationUpdate holds the location fields clients may change; nil fields
+// are left as they are
+type LocationUpdate struct {
+	BusinessName *string `json:"business_name"`
+	BusinessType *string `json:"business_type"`
+	Address      *string `json:"address"`
+	City         *string `json:"city"`
+	State        *string `json:"state"`
+	ZipCode      *string `json:"zip_code"`
+	Country      *string `json:"country"`
+	Phone        *string `json:"phone"`
+	Email        *string `json:"email"`
+	Website      *string `json:"website"`
+}
+
+// Replacement returns the update setting every field, clearing those left
+// out of u
+func (u LocationUpdate) Replacement() LocationUpdate {
+	for _, field := range u.fields() {
+		if *field.value == nil {
+			*field.value = new(string)
+		}
+	}
+	return u
+}
+
+// Validate checks the fields the update sets
+func (u *LocationUpdate) Validate() error {
+	set := 0
+	for _, field := range u.fields() {
+		if *field.value == nil {
+			continue
+		}
+		set++
+		if len(strings.TrimSpace(**field.value)) > maxLocationFieldLength {
+			return fmt.Errorf("%w: %s must be at most %d characters", ErrInvalidLocation, field.column, maxLocationFieldLength)
+		}
+	}
+	if set == 0 {
+		return fmt.Errorf("%w: no fields to update", ErrInvalidLocation)
+	}
+
+	if u.BusinessName != nil && strings.TrimSpace(*u.BusinessName) == "" {
+		return fmt.Errorf("%w: business_name must not be empty", ErrInvalidLocation)
+	}
+	if u.Email != nil && strings.TrimSpace(*u.Email) != "" {
+		email := strings.TrimSpace(*u.Email)
+		if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+			return fmt.Errorf("%w: email is not a valid address", ErrInvalidLocation)
+		}
+	}
+	if u.Website != nil && strings.TrimSpace(*u.Website) != "" {
+		website, err := url.Parse(strings.TrimSpace(*u.Website))
+		if err != nil || (website.Scheme != "http" && website.Scheme != "https") || website.Host == "" {
+			return fmt.Errorf("%w: website must be an http or https URL", ErrInvalidLocation)
+		}
+	}
+	if u.Phone != nil && strings.ContainsFunc(*u.Phone, func(r rune) bool { return !strings.ContainsRune("0123456789+-() .", r) }) {
+		return fmt.Errorf("%w: phone may only contain digits, spaces and + - ( ) .", ErrInvalidLocation)
+	}
+	return nil
+}
+
+// columns returns the trimmed values the update sets by column
+func (u *LocationUpdate) columns() map[string]interface{} {
+	columns := make(map[string]interface{})
+	for _, field := range u.fields() {
+		if *field.value != nil {
+			columns[field.column] = strings.TrimSpace(**field.value)
+		}
+	}
+	return columns
+}
+
+type locationField struct {
+	column string
+	value  **string
+}
+
+func (u *LocationUpdate) fields() []locationField {
+	return []locationField{
+		{"business_name", &u.BusinessName},
+		{"business_type", &u.BusinessType},
+		{"address", &u.Address},
+		{"city", &u.City},
+		{"state", &u.State},
+		{"zip_code", &u.ZipCode},
+		{"country", &u.Country},
+		{"phone", &u.Phone},
+		{"email", &u.Email},
+		{"website", &u.Website},
+	}
+}
+
+// LocationUpdateResult is a saved location update and whether it reached
+// the CRM
+type LocationUpdateResult struct {
+	Location *models.Location
+	// Pushed is set once the saved location has been sent to the CRM
+	Pushed bool
+	// PushError is why the saved location could not be sent to the CRM; the
+	// CRM keeps its old details until the location is next updated
+	PushError error
+}
+
+// UpdateLocation applies update to an active location of a company and
+// returns the result. A location of another company is ErrLocationNotFound.
+// A version above 0 makes the update conditional on the location still
+// being at that version, failing with ErrLocationVersionMismatch otherwise.
+// With LocationUpstreamPush the saved change is then sent to the CRM; that
+// failing does not undo the update and is reported in the result instead.
+func (bs *BusinessService) UpdateLocation(ctx context.Context, companyID, locationID string, update LocationUpdate, version int64) (*LocationUpdateResult, error) {
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+
+	db := bs.db.WithContext(ctx)
+	location, err := updateLocationVersion(db, companyID, locationID, update.columns(), version)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := bs.db.Model(location).Updates(updates).Error; err != nil {
-		return fmt.Errorf("failed to update location: %w", err)
+	// Invalidate the location and its company's location list
+	if err := bs.cache.InvalidateTags(ctx, LocationTag(locationID), CompanyTag(companyID)); err != nil {
+		bs.logger.WarnContext(ctx, "Failed to invalidate cached location", "location_id", locationID, "error", err)
 	}
+	bs.logger.InfoContext(ctx, "Updated location", "location_id", locationID, "version", location.Version)
+
+	result := &LocationUpdateResult{Location: location}
+	if bs.config.LocationUpstreamPush {
+		if err := bs.pushLocation(ctx, companyID, location); err != nil {
+			bs.logger.WarnContext(ctx, "Updated location was not pushed to the CRM", "location_id", locationID, "version", location.Version, "error", err)
+			result.PushError = err
+		} else {
+			result.Pushed = true
+		}
+	}
+	return result, nil
+}
 
-	// Invalidate cache
-	cacheKey := fmt.Sprintf("location:%s", locationID)
-	bs.cache.Delete(cacheKey)
+// updateLocationVersion sets columns on an active location of a company and
+// increments its version, only if it is still at version when that is above
+// 0, and returns the location as saved
+func updateLocationVersion(db *gorm.DB, companyID, locationID string, columns map[string]interface{}, version int64) (*models.Location, error) {
+	location := &models.Location{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		owned := func(query *gorm.DB) *gorm.DB {
+			companies := tx.Model(&models.Company{}).Select("id").Where("company_id = ?", companyID)
+			return query.Where("location_id = ? AND is_active = ? AND company_id IN (?)", locationID, true, companies)
+		}
 
-	return nil
+		columns["version"] = gorm.Expr("version + 1")
+		query := owned(tx.Model(&models.Location{}))
+		if version > 0 {
+			query = query.Where("version = ?", version)
+		}
+		result := query.Updates(columns)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update location: %w", result.Error)
+		}
+
+		err := owned(tx).First(location).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrLocationNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load location: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: location is at version %d, not %d", ErrLocationVersionMismatch, location.Version, version)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+// InvalidateCompany drops every cached entry derived from a company: the
+// company itself, its locations, and their contacts and products
+func (bs *BusinessService) InvalidateCompany(ctx context.Context, companyID string) error {
+	var locationIDs []string
+	err := bs.db.WithContext(ctx).Model(&models.Location{}).
+		Joins("JOIN companies ON companies.id = locations.company_id").
+		Where("companies.company_id = ?", companyID).
+		Pluck("locations.location_id", &locationIDs).Error
+	if err != nil {
+		return fmt.Errorf("failed to list locations of company %s: %w", companyID, err)
+	}
+
+	tags := []string{CompanyTag(companyID)}
+	for _, locationID := range locationIDs {
+		tags = append(tags, LocationTag(locationID))
+	}
+	return bs.cache.InvalidateTags(ctx, tags...)
 }
 
 // SyncLocationData syncs location data with external API
-func (bs *BusinessService) SyncLocationData(companyID string) error {
+func (bs *BusinessService) SyncLocationData(ctx context.Context, companyID string) error {
 	// Fetch fresh data from Nango
-	locations, err := bs.nango.GetLocations(companyID)
+	locations, err := bs.nango.GetLocations(ctx, companyID)
 	if err != nil {
 		return fmt.Errorf("failed to sync location data: %w", err)
 	}
 
-	// Update cache
-	cacheKey := fmt.Sprintf("locations:%s", companyID)
-	bs.cache.Set(cacheKey, locations, 15*time.Minute)
+	// Drop cached company data so the next reads load the synced locations
+	if err := bs.InvalidateCompany(ctx, companyID); err != nil {
+		bs.logger.WarnContext(ctx, "Failed to invalidate cached company data", "company_id", companyID, "error", err)
+	}
 
-	// Sync contacts and products for each location
+	// Sync contacts and products for each location in the background, on
+	// the service's context so they run past the request but stop on shutdown
 	for _, location := range locations {
+		bs.workers.Add(1)
 		go func(loc models.Location) {
-			bs.fetchAndSaveContacts(&loc)
-			bs.fetchAndSaveProducts(&loc)
+			defer bs.workers.Done()
+			bs.fetchAndSaveContacts(bs.background, &loc)
+			bs.fetchAndSaveProducts(bs.background, &loc)
 		}(location)
 	}
 
 	return nil
 }
 
+// CountEntities returns the number of stored companies, locations, contacts
+// and products
+func (bs *BusinessService) CountEntities(ctx context.Context) (map[string]int64, error) {
+	entities := []struct {
+		name  string
+		model interface{}
+	}{
+		{"companies", &models.Company{}},
+		{"locations", &models.Location{}},
+		{"contacts", &models.Contact{}},
+		{"products", &models.Product{}},
+	}
+
+	counts := make(map[string]int64, len(entities))
+	for _, entity := range entities {
+		var count int64
+		if err := bs.db.WithContext(ctx).Model(entity.model).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", entity.name, err)
+		}
+		counts[entity.name] = count
+	}
+
+	return counts, nil
+}
+
+// Stop waits for background sync workers to finish, cancelling them if ctx
+// ends first
+func (bs *BusinessService) Stop(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		bs.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		bs.logger.WarnContext(ctx, "Timeout waiting for sync workers, cancelling them")
+	}
+	bs.stopBackground()
+}
+
 // Private helper methods
 
-func (bs *BusinessService) fetchAndSaveContacts(location *models.Location) ([]models.Contact, error) {
+// pushLocation sends an updated location to the CRM
+func (bs *BusinessService) pushLocation(ctx context.Context, companyID string, location *models.Location) error {
+	company := &models.Company{}
+	if err := bs.db.WithContext(ctx).First(company, "company_id = ?", companyID).Error; err != nil {
+		return fmt.Errorf("failed to find company of location: %w", err)
+	}
+	if err := bs.nango.UpdateLocation(ctx, company, location); err != nil {
+		return fmt.Errorf("failed to push location upstream: %w", err)
+	}
+	return nil
+}
+
+func (bs *BusinessService) fetchAndSaveContacts(ctx context.Context, location *models.Location) ([]models.Contact, error) {
 	// This would typically call an external API to fetch contacts
 	// For now, we'll return an empty slice as this depends on the specific API
 	var contacts []models.Contact
@@ -263,13 +504,13 @@ func (bs *BusinessService) fetchAndSaveContacts(location *models.Location) ([]mo
 	// Save contacts to database
 	for _, contact := range contacts {
 		contact.LocationID = location.ID
-		bs.db.FirstOrCreate(&contact, "location_id = ? AND email = ?", contact.LocationID, contact.Email)
+		bs.db.WithContext(ctx).FirstOrCreate(&contact, "location_id = ? AND email = ?", contact.LocationID, contact.Email)
 	}
 
 	return contacts, nil
 }
 
-func (bs *BusinessService) fetchAndSaveProducts(location *models.Location) ([]models.Product, error) {
+func (bs *BusinessService) fetchAndSaveProducts(ctx context.Context, location *models.Location) ([]models.Product, error) {
 	// This would typically call an external API to fetch products
 	// For now, we'll return an empty slice as this depends on the specific API
 	var products []models.Product
@@ -283,7 +524,7 @@ func (bs *BusinessService) fetchAndSaveProducts(location *models.Location) ([]mo
 	// Save products to database
 	for _, product := range products {
 		product.LocationID = location.ID
-		bs.db.FirstOrCreate(&product, "location_id = ? AND sku = ?", product.LocationID, product.SKU)
+		bs.db.WithContext(ctx).FirstOrCreate(&product, "location_id = ? AND sku = ?", product.LocationID, product.SKU)
 	}
 
 	return products, nil
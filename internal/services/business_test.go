@@ -0,0 +1,141 @@
+package services
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestLocationUpdateValidate(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	valid := LocationUpdate{
+		BusinessName: str("  Main Street Store "),
+		Phone:        str("+1 (555) 010-0100"),
+		Email:        str("store@example.com"),
+		Website:      str("https://example.com/store"),
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	columns := valid.columns()
+	if len(columns) != 4 || columns["business_name"] != "Main Street Store" {
+		t.Errorf("got columns %v, want only the given fields, trimmed", columns)
+	}
+
+	invalid := map[string]LocationUpdate{
+		"no fields":     {},
+		"empty name":    {BusinessName: str(" ")},
+		"long field":    {City: str(strings.Repeat("a", maxLocationFieldLength+1))},
+		"bad email":     {Email: str("Store <store@example.com>")},
+		"bad website":   {Website: str("javascript:alert(1)")},
+		"letters phone": {Phone: str("555-CALL")},
+	}
+	for name, update := range invalid {
+		if err := update.Validate(); !errors.Is(err, ErrInvalidLocation) {
+			t.Errorf("%s: got %v, want ErrInvalidLocation", name, err)
+		}
+	}
+
+	// A replacement clears the fields left out, and still needs a name
+	replacement := LocationUpdate{BusinessName: str("Store")}.Replacement()
+	if columns := replacement.columns(); len(columns) != 10 || columns["website"] != "" {
+		t.Errorf("got columns %v, want every field set", columns)
+	}
+	nameless := LocationUpdate{City: str("Springfield")}.Replacement()
+	if err := nameless.Validate(); !errors.Is(err, ErrInvalidLocation) {
+		t.Errorf("got %v, want a replacement without a name refused", err)
+	}
+}
+
+// newTestDB returns a Postgres gorm.DB backed by sqlmock, whose
+// expectations match queries by regular expression
+func newTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return db, mock
+}
+
+func TestUpdateLocationVersion(t *testing.T) {
+	locationColumns := []string{"location_id", "business_name", "version"}
+	updateQuery := `UPDATE "locations" SET "business_name"=\$1,"version"=version \+ 1,"updated_at"=\$2 ` +
+		`WHERE \(location_id = \$3 AND is_active = \$4 AND company_id IN \(SELECT "id" FROM "companies" WHERE company_id = \$5 AND "companies"."deleted_at" IS NULL\)\)`
+	selectQuery := `SELECT \* FROM "locations" WHERE \(location_id = \$1 AND is_active = \$2 AND company_id IN \(SELECT "id" FROM "companies" WHERE company_id = \$3`
+
+	tests := []struct {
+		name        string
+		version     int64
+		rowsUpdated int64
+		// the version the location is at after the update
+		savedVersion int64
+		wantErr      error
+	}{
+		{"current version increments", 3, 1, 4, nil},
+		{"stale version changes nothing", 2, 0, 3, ErrLocationVersionMismatch},
+		{"any version skips the check", 0, 1, 4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := newTestDB(t)
+			query := updateQuery
+			args := []driver.Value{"Store", sqlmock.AnyArg(), "loc-1", true, "company-1"}
+			if tt.version > 0 {
+				query += ` AND version = \$6`
+				args = append(args, tt.version)
+			}
+			query += ` AND "locations"."deleted_at" IS NULL$`
+
+			mock.ExpectBegin()
+			mock.ExpectExec(query).WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, tt.rowsUpdated))
+			mock.ExpectQuery(selectQuery).WillReturnRows(sqlmock.NewRows(locationColumns).AddRow("loc-1", "Store", tt.savedVersion))
+			if tt.wantErr != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+			}
+
+			columns := map[string]interface{}{"business_name": "Store"}
+			location, err := updateLocationVersion(db, "company-1", "loc-1", columns, tt.version)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && location.Version != tt.savedVersion {
+				t.Errorf("got version %d, want %d", location.Version, tt.savedVersion)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUpdateLocationOfOtherCompany(t *testing.T) {
+	db, mock := newTestDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "locations" .* company_id IN \(SELECT "id" FROM "companies" WHERE company_id = `).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT \* FROM "locations"`).WillReturnRows(sqlmock.NewRows([]string{"location_id"}))
+	mock.ExpectRollback()
+
+	_, err := updateLocationVersion(db, "company-2", "loc-1", map[string]interface{}{"business_name": "Store"}, 0)
+	if !errors.Is(err, ErrLocationNotFound) {
+		t.Fatalf("got %v, want ErrLocationNotFound", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
\ No newline at end of file
@@ -4,21 +4,51 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/patrickmn/go-cache"
+	"golang.org/x/sync/singleflight"
 	"marketplace-app/internal/config"
+	"marketplace-app/internal/telemetry"
 )
 
+// CacheService is a two-tier cache. L1 is a small in-process LRU with a short
+// TTL, populated on reads and writes; L2 is Redis, shared by all replicas.
+// Writes and deletes are published on Redis so other replicas drop their L1
+// copies; a missed invalidation is bounded by the L1 TTL. When Redis is
+// unavailable values live in an in-memory fallback. Redis keys are namespaced
+// with CacheKeyPrefix.
 type CacheService struct {
 	redisClient *redis.Client
 	memoryCache *cache.Cache
 	config      *config.Config
-	ctx         context.Context
+
+	// local is the L1 cache, nil when disabled or Redis is unavailable
+	local         *expirable.LRU[string, localEntry]
+	invalidations *redis.PubSub
+	subscriber    sync.WaitGroup
+
+	// loads deduplicates concurrent GetOrLoad loads per key
+	loads singleflight.Group
+	// tagsMu guards tag sets in the memory fallback
+	tagsMu sync.Mutex
+
+	stats *cacheStats
+	// removing is set while removeMu is held to delete entries on purpose,
+	// so eviction callbacks only count entries a tier dropped on its own
+	removeMu sync.Mutex
+	removing atomic.Bool
+
+	logger *slog.Logger
 }
 
-func NewCacheService(cfg *config.Config) *CacheService {
+func NewCacheService(cfg *config.Config, logger *slog.Logger) *CacheService {
 	ctx := context.Background()
 
 	// Initialize Redis client
@@ -38,117 +68,258 @@ func NewCacheService(cfg *config.Config) *CacheService {
 	_, err = redisClient.Ping(ctx).Result()
 	if err != nil {
 		// If Redis is not available, we'll rely on memory cache only
+		logger.Warn("Redis unavailable, using in-memory cache only", "error", err)
 		redisClient = nil
+	} else {
+		// Trace Redis commands
+		redisClient.AddHook(telemetry.RedisHook{})
 	}
 
 	// Initialize in-memory cache as fallback
 	memoryCache := cache.New(time.Duration(cfg.CacheExpiration)*time.Minute, 10*time.Minute)
 
-	return &CacheService{
+	cs := &CacheService{
 		redisClient: redisClient,
 		memoryCache: memoryCache,
 		config:      cfg,
-		ctx:         ctx,
+		stats:       newCacheStats(),
+		logger:      logger,
 	}
+	memoryCache.OnEvicted(func(key string, _ interface{}) {
+		cs.countEviction("memory", key)
+	})
+
+	// The L1 cache only fronts Redis; the memory fallback is local already
+	if redisClient != nil && cfg.CacheL1Size > 0 && cfg.CacheL1TTL > 0 {
+		cs.startLocal(ctx)
+	}
+
+	return cs
 }
 
-// Set stores a value in cache with expiration
-func (cs *CacheService) Set(key string, value interface{}, expiration time.Duration) error {
-	// Try Redis first
+// encodedValue is a JSON-encoded entry in the memory cache. Values are
+// stored encoded in every tier so a read decodes into the same type whichever
+// tier served it, and callers never share a cached pointer.
+type encodedValue []byte
+
+// GetJSON retrieves the value stored under key decoded as T, reporting
+// whether it was found
+func GetJSON[T any](ctx context.Context, cs *CacheService, key string) (T, bool) {
+	var value T
+	if !cs.GetInto(ctx, key, &value) {
+		var zero T
+		return zero, false
+	}
+	return value, true
+}
+
+// SetJSON stores value under key with expiration
+func SetJSON[T any](ctx context.Context, cs *CacheService, key string, value T, expiration time.Duration) error {
+	return cs.Set(ctx, key, value, expiration)
+}
+
+// Set stores a value in cache with expiration. The value is JSON-encoded, so
+// fields hidden from JSON such as tokens are never cached; read it back with
+// GetJSON or GetInto.
+func (cs *CacheService) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return cs.SetTagged(ctx, key, value, expiration, nil)
+}
+
+// SetTagged is Set that also records key under each tag, so InvalidateTags
+// can delete it along with everything else derived from the same data
+func (cs *CacheService) SetTagged(ctx context.Context, key string, value interface{}, expiration time.Duration, tags []string) error {
+	defer cs.recordLatency(cacheOpSet, time.Now())
+
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache value for %s: %w", key, err)
+	}
+
+	// Try Redis first, telling other replicas to drop their L1 copy
 	if cs.redisClient != nil {
-		jsonData, err := json.Marshal(value)
+		_, err := cs.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, cs.key(key), jsonData, expiration)
+			cs.tagRedis(ctx, pipe, key, expiration, tags)
+			return cs.publishInvalidation(ctx, pipe, cs.invalidation(key))
+		})
 		if err == nil {
-			err = cs.redisClient.Set(cs.ctx, key, jsonData, expiration).Err()
-			if err == nil {
-				return nil
-			}
+			cs.setLocal(key, jsonData, expiration)
+			return nil
 		}
+		cs.forgetLocal(key)
 	}
 
 	// Fallback to memory cache
-	cs.memoryCache.Set(key, value, expiration)
+	cs.memoryCache.Set(key, encodedValue(jsonData), expiration)
+	cs.tagMemory(key, expiration, tags)
 	return nil
 }
 
-// Get retrieves a value from cache
-func (cs *CacheService) Get(key string) interface{} {
+// GetInto decodes the value stored under key into dest, which must be a
+// pointer, and reports whether it was found. An entry that no longer decodes
+// into dest, for instance after the cached type changed, counts as a miss.
+func (cs *CacheService) GetInto(ctx context.Context, key string, dest interface{}) bool {
+	data, tier, found := cs.lookup(ctx, key)
+	if !found {
+		return false
+	}
+
+	if err := json.Unmarshal(data, dest); err != nil {
+		cs.logger.WarnContext(ctx, "Failed to decode cached value", "key", key, "tier", tier, "error", err)
+		return false
+	}
+	return true
+}
+
+// SetNX stores a value only if the key does not already exist and reports
+// whether it was stored
+func (cs *CacheService) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+
 	// Try Redis first
 	if cs.redisClient != nil {
-		val, err := cs.redisClient.Get(cs.ctx, key).Result()
+		ok, err := cs.redisClient.SetNX(ctx, cs.key(key), jsonData, expiration).Result()
 		if err == nil {
-			// Try to unmarshal as generic interface{}
-			var result interface{}
-			if json.Unmarshal([]byte(val), &result) == nil {
-				return result
-			}
-			// Return raw string if unmarshal fails
-			return val
+			return ok, nil
 		}
 	}
 
 	// Fallback to memory cache
-	if value, found := cs.memoryCache.Get(key); found {
-		return value
+	return cs.memoryCache.Add(key, encodedValue(jsonData), expiration) == nil, nil
+}
+
+// Get retrieves a value from cache decoded into generic JSON types; use
+// GetJSON to decode into a concrete type
+func (cs *CacheService) Get(ctx context.Context, key string) interface{} {
+	data, _, found := cs.lookup(ctx, key)
+	if !found {
+		return nil
 	}
 
-	return nil
+	// Try to unmarshal as generic interface{}
+	var result interface{}
+	if json.Unmarshal(data, &result) == nil {
+		return result
+	}
+	// Return raw string if unmarshal fails
+	return string(data)
 }
 
-// GetString retrieves a string value from cache
-func (cs *CacheService) GetString(key string) (string, bool) {
-	// Try Redis first
+// GetString retrieves the raw stored form of a value from cache
+func (cs *CacheService) GetString(ctx context.Context, key string) (string, bool) {
+	data, _, found := cs.lookup(ctx, key)
+	if !found {
+		return "", false
+	}
+	return string(data), true
+}
+
+// lookup reads the stored form of key from L1, then Redis, then the memory
+// fallback, and reports which tier served it. Redis hits populate L1.
+func (cs *CacheService) lookup(ctx context.Context, key string) (encodedValue, string, bool) {
+	defer cs.recordLatency(cacheOpGet, time.Now())
+
+	if data, ok := cs.getLocal(key); ok {
+		return data, "l1", true
+	}
+
+	// Try Redis next
 	if cs.redisClient != nil {
-		val, err := cs.redisClient.Get(cs.ctx, key).Result()
-		if err == nil {
-			return val, true
+		var get *redis.StringCmd
+		var ttl *redis.DurationCmd
+		cs.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			get = pipe.Get(ctx, cs.key(key))
+			ttl = pipe.PTTL(ctx, cs.key(key))
+			return nil
+		})
+		if data, err := get.Bytes(); err == nil {
+			cs.recordLookup("redis", key, true)
+			cs.setLocal(key, data, ttl.Val())
+			return data, "redis", true
 		}
+		cs.recordLookup("redis", key, false)
 	}
 
 	// Fallback to memory cache
 	if value, found := cs.memoryCache.Get(key); found {
-		if str, ok := value.(string); ok {
-			return str, true
+		switch v := value.(type) {
+		case encodedValue:
+			cs.recordLookup("memory", key, true)
+			return v, "memory", true
+		case string:
+			cs.recordLookup("memory", key, true)
+			return encodedValue(v), "memory", true
+		case int64:
+			// Counters kept by Increment
+			cs.recordLookup("memory", key, true)
+			return encodedValue(strconv.FormatInt(v, 10)), "memory", true
 		}
 	}
+	cs.recordLookup("memory", key, false)
 
-	return "", false
+	return nil, "", false
 }
 
 // Delete removes a value from cache
-func (cs *CacheService) Delete(key string) error {
+func (cs *CacheService) Delete(ctx context.Context, key string) error {
+	defer cs.recordLatency(cacheOpDelete, time.Now())
+
+	cs.forgetLocal(key)
+
 	// Delete from Redis
 	if cs.redisClient != nil {
-		cs.redisClient.Del(cs.ctx, key)
+		cs.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, cs.key(key))
+			return cs.publishInvalidation(ctx, pipe, cs.invalidation(key))
+		})
 	}
 
 	// Delete from memory cache
-	cs.memoryCache.Delete(key)
+	cs.deleteMemory(key)
 	return nil
 }
 
-// DeletePattern deletes all keys matching a pattern (Redis only)
-func (cs *CacheService) DeletePattern(pattern string) error {
-	if cs.redisClient == nil {
-		return fmt.Errorf("Redis not available for pattern deletion")
-	}
+// Remove deletes a key like Delete and reports whether it was stored.
+// When instances remove the same key at once only one is told it was, so
+// the removal can gate work that must happen once.
+func (cs *CacheService) Remove(ctx context.Context, key string) (bool, error) {
+	defer cs.recordLatency(cacheOpDelete, time.Now())
 
-	keys, err := cs.redisClient.Keys(cs.ctx, pattern).Result()
-	if err != nil {
-		return err
-	}
+	cs.forgetLocal(key)
+
+	var inMemory bool
+	cs.removeExplicitly(func() {
+		_, inMemory = cs.memoryCache.Get(key)
+		cs.memoryCache.Delete(key)
+	})
 
-	if len(keys) > 0 {
-		return cs.redisClient.Del(cs.ctx, keys...).Err()
+	if cs.redisClient != nil {
+		var del *redis.IntCmd
+		cs.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			del = pipe.Del(ctx, cs.key(key))
+			return cs.publishInvalidation(ctx, pipe, cs.invalidation(key))
+		})
+		if err := del.Err(); err != nil && !inMemory {
+			return false, err
+		}
+		return del.Val() > 0 || inMemory, nil
 	}
 
-	return nil
+	return inMemory, nil
 }
 
 // Exists checks if a key exists in cache
-func (cs *CacheService) Exists(key string) bool {
-	// Check Redis first
+func (cs *CacheService) Exists(ctx context.Context, key string) bool {
+	if cs.local != nil && cs.local.Contains(key) {
+		return true
+	}
+
+	// Check Redis next
 	if cs.redisClient != nil {
-		count, err := cs.redisClient.Exists(cs.ctx, key).Result()
+		count, err := cs.redisClient.Exists(ctx, cs.key(key)).Result()
 		if err == nil && count > 0 {
 			return true
 		}
@@ -160,10 +331,12 @@ func (cs *CacheService) Exists(key string) bool {
 }
 
 // Increment increments a numeric value in cache
-func (cs *CacheService) Increment(key string, delta int64) (int64, error) {
+func (cs *CacheService) Increment(ctx context.Context, key string, delta int64) (int64, error) {
+	cs.forgetLocal(key)
+
 	// Try Redis first
 	if cs.redisClient != nil {
-		val, err := cs.redisClient.IncrBy(cs.ctx, key, delta).Result()
+		val, err := cs.redisClient.IncrBy(ctx, cs.key(key), delta).Result()
 		if err == nil {
 			return val, nil
 		}
@@ -184,49 +357,46 @@ func (cs *CacheService) Increment(key string, delta int64) (int64, error) {
 }
 
 // SetExpiration sets expiration for an existing key (Redis only)
-func (cs *CacheService) SetExpiration(key string, expiration time.Duration) error {
+func (cs *CacheService) SetExpiration(ctx context.Context, key string, expiration time.Duration) error {
 	if cs.redisClient == nil {
 		return fmt.Errorf("Redis not available for setting expiration")
 	}
 
-	return cs.redisClient.Expire(cs.ctx, key, expiration).Err()
+	return cs.redisClient.Expire(ctx, cs.key(key), expiration).Err()
 }
 
 // GetTTL gets the time to live for a key
-func (cs *CacheService) GetTTL(key string) (time.Duration, error) {
+func (cs *CacheService) GetTTL(ctx context.Context, key string) (time.Duration, error) {
 	if cs.redisClient == nil {
 		return 0, fmt.Errorf("Redis not available for TTL")
 	}
 
-	return cs.redisClient.TTL(cs.ctx, key).Result()
-}
-
-// FlushAll clears all cache entries
-func (cs *CacheService) FlushAll() error {
-	// Flush Redis
-	if cs.redisClient != nil {
-		if err := cs.redisClient.FlushAll(cs.ctx).Err(); err != nil {
-			return err
-		}
-	}
-
-	// Flush memory cache
-	cs.memoryCache.Flush()
-	return nil
+	return cs.redisClient.TTL(ctx, cs.key(key)).Result()
 }
 
-// GetStats returns cache statistics
-func (cs *CacheService) GetStats() map[string]interface{} {
+// GetStats returns cache statistics: item counts, hits, misses and
+// evictions per key prefix and tier since startup, recent latency
+// percentiles per operation and Redis memory and keyspace stats
+func (cs *CacheService) GetStats(ctx context.Context) map[string]interface{} {
 	stats := make(map[string]interface{})
 
 	// Memory cache stats
+	stats["key_prefix"] = cs.config.CacheKeyPrefix
 	stats["memory_items"] = cs.memoryCache.ItemCount()
+	stats["l1_enabled"] = cs.local != nil
+	if cs.local != nil {
+		stats["l1_items"] = cs.local.Len()
+	}
+	stats["prefixes"] = cs.stats.prefixes()
+	stats["latency"] = cs.stats.latencies()
 
 	// Redis stats (if available)
 	if cs.redisClient != nil {
-		info, err := cs.redisClient.Info(cs.ctx, "memory").Result()
+		redisStats, err := cs.redisStats(ctx)
 		if err == nil {
-			stats["redis_info"] = info
+			stats["redis"] = redisStats
+		} else {
+			cs.logger.WarnContext(ctx, "Failed to read Redis stats", "error", err)
 		}
 		stats["redis_available"] = true
 	} else {
@@ -236,15 +406,25 @@ func (cs *CacheService) GetStats() map[string]interface{} {
 	return stats
 }
 
-// Close closes the cache connections
+// Close stops receiving invalidations and closes the cache connections
 func (cs *CacheService) Close() {
+	if cs.invalidations != nil {
+		cs.invalidations.Close()
+		cs.subscriber.Wait()
+	}
 	if cs.redisClient != nil {
 		cs.redisClient.Close()
 	}
 }
 
+// key namespaces a cache key in Redis so replicas of this service can share
+// a Redis with other applications
+func (cs *CacheService) key(key string) string {
+	return cs.config.CacheKeyPrefix + key
+}
+
 // Health checks the health of cache services
-func (cs *CacheService) Health() map[string]bool {
+func (cs *CacheService) Health(ctx context.Context) map[string]bool {
 	health := make(map[string]bool)
 
 	// Check memory cache (always healthy if service exists)
@@ -252,11 +432,11 @@ func (cs *CacheService) Health() map[string]bool {
 
 	// Check Redis
 	if cs.redisClient != nil {
-		_, err := cs.redisClient.Ping(cs.ctx).Result()
+		_, err := cs.redisClient.Ping(ctx).Result()
 		health["redis"] = err == nil
 	} else {
 		health["redis"] = false
 	}
 
 	return health
-}
\ No newline at end of file
+}
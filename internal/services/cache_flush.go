@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownCacheCategory is returned when flushing a category that does
+// not exist
+var ErrUnknownCacheCategory = errors.New("unknown cache category")
+
+// Cache flush categories
+const (
+	CacheCategoryBusiness   = "business"
+	CacheCategoryOAuthState = "oauth_state"
+	CacheCategoryRateLimit  = "rate_limit"
+	CacheCategoryAlerts     = "alerts"
+)
+
+// flushBatchSize is the SCAN page size and the most keys deleted per UNLINK
+const flushBatchSize = 500
+
+// cacheCategories lists the key prefixes in each flush category. Lock keys
+// and daily quota counters belong to no category, so a flush never releases
+// a held lock or resets a tenant's quota.
+var cacheCategories = map[string][]string{
+	CacheCategoryBusiness:   {"company:", "locations:", "location:", "contacts:", "products:", "plan:", "tag:", "cache:"},
+	CacheCategoryOAuthState: {"oauth_state:", "ghl_oauth_state:"},
+	CacheCategoryRateLimit:  {"rate_limit:"},
+	CacheCategoryAlerts:     {"alert_active:", "alert_sent:"},
+}
+
+// CacheCategories returns the names of the flush categories
+func CacheCategories() []string {
+	categories := make([]string, 0, len(cacheCategories))
+	for category := range cacheCategories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// FlushResult reports how many keys a flush deleted, or would delete on a
+// dry run, per category
+type FlushResult struct {
+	DryRun     bool             `json:"dry_run"`
+	Categories map[string]int64 `json:"categories"`
+	Total      int64            `json:"total"`
+}
+
+// Flush deletes the keys in the given categories, or in every category when
+// none are given. Only keys in this service's namespace are touched: Redis
+// is walked with SCAN over the key prefix rather than FLUSHALL. A dry run
+// only counts the keys.
+func (cs *CacheService) Flush(ctx context.Context, dryRun bool, categories ...string) (*FlushResult, error) {
+	if len(categories) == 0 {
+		categories = CacheCategories()
+	}
+	for _, category := range categories {
+		if _, ok := cacheCategories[category]; !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownCacheCategory, category)
+		}
+	}
+
+	result := &FlushResult{DryRun: dryRun, Categories: make(map[string]int64, len(categories))}
+	for _, category := range categories {
+		for _, prefix := range cacheCategories[category] {
+			count, err := cs.flushPrefix(ctx, prefix, dryRun)
+			if err != nil {
+				return nil, fmt.Errorf("failed to flush %s cache: %w", category, err)
+			}
+			result.Categories[category] += count
+			result.Total += count
+		}
+	}
+
+	if !dryRun {
+		// Other categories rarely sit in L1; dropping all of it is simpler
+		// than tracking which entries belong where
+		if cs.local != nil {
+			cs.removeExplicitly(cs.local.Purge)
+		}
+		if err := cs.publishInvalidation(ctx, nil, cacheInvalidation{Origin: cs.config.InstanceID, Flush: true}); err != nil {
+			cs.logger.WarnContext(ctx, "Failed to publish cache flush", "error", err)
+		}
+		cs.logger.InfoContext(ctx, "Flushed cache", "categories", categories, "keys", result.Total)
+	}
+
+	return result, nil
+}
+
+// flushPrefix deletes, or counts, the keys starting with prefix in Redis and
+// the memory fallback
+func (cs *CacheService) flushPrefix(ctx context.Context, prefix string, dryRun bool) (int64, error) {
+	var count int64
+
+	if cs.redisClient != nil {
+		iter := cs.redisClient.Scan(ctx, 0, escapeGlob(cs.key(prefix))+"*", flushBatchSize).Iterator()
+		batch := make([]string, 0, flushBatchSize)
+		for iter.Next(ctx) {
+			count++
+			if dryRun {
+				continue
+			}
+			batch = append(batch, iter.Val())
+			if len(batch) == flushBatchSize {
+				if err := cs.redisClient.Unlink(ctx, batch...).Err(); err != nil {
+					return count, err
+				}
+				batch = batch[:0]
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return count, err
+		}
+		if len(batch) > 0 {
+			if err := cs.redisClient.Unlink(ctx, batch...).Err(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	for key := range cs.memoryCache.Items() {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		count++
+		if !dryRun {
+			cs.deleteMemory(key)
+		}
+	}
+
+	return count, nil
+}
+
+// escapeGlob escapes the characters SCAN MATCH treats as wildcards
+func escapeGlob(s string) string {
+	var escaped strings.Builder
+	for _, ch := range s {
+		switch ch {
+		case '*', '?', '[', ']', '\\':
+			escaped.WriteByte('\\')
+		}
+		escaped.WriteRune(ch)
+	}
+	return escaped.String()
+}
\ No newline at end of file
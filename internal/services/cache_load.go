@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"marketplace-app/internal/metrics"
+)
+
+// Reasons GetOrLoad runs a loader
+const (
+	loadOnMiss  = "miss"
+	loadOnStale = "stale"
+	loadEarly   = "early"
+)
+
+// loadedEntry is how GetOrLoad stores a value: with its logical expiry, and
+// how long it took to load so early expiration can scale with the cost of
+// a reload. The Redis key outlives ExpiresAt by the stale window.
+type loadedEntry[T any] struct {
+	Value     T     `json:"value"`
+	ExpiresAt int64 `json:"expires_at"` // Unix milliseconds
+	LoadMs    int64 `json:"load_ms"`
+}
+
+// GetOrLoad returns the value cached under key, calling loader to produce
+// and cache it for ttl, under tags, when it is missing. Concurrent misses on this
+// instance share a single load. Once ttl has passed the stale value is
+// still served for CacheStaleWhileRevalidate while one caller reloads it in
+// the background, and fresh values are reloaded early with a probability
+// that rises as expiry approaches (XFetch), so hot keys rarely expire
+// under load. Values read this way must be written with GetOrLoad too.
+func GetOrLoad[T any](ctx context.Context, cs *CacheService, key string, ttl time.Duration, tags []string, loader func(ctx context.Context) (T, error)) (T, error) {
+	var entry loadedEntry[T]
+	if cs.GetInto(ctx, key, &entry) {
+		now := time.Now()
+		expiresAt := time.UnixMilli(entry.ExpiresAt)
+		switch {
+		case now.Before(expiresAt):
+			if cs.expiresEarly(now, expiresAt, time.Duration(entry.LoadMs)*time.Millisecond) {
+				reloadInBackground(ctx, cs, key, ttl, tags, loadEarly, loader)
+			}
+			return entry.Value, nil
+		case now.Before(expiresAt.Add(cs.config.CacheStaleWhileRevalidate)):
+			reloadInBackground(ctx, cs, key, ttl, tags, loadOnStale, loader)
+			return entry.Value, nil
+		}
+	}
+
+	results := cs.loads.DoChan(key, func() (interface{}, error) {
+		return loadAndStore(ctx, cs, key, ttl, tags, loadOnMiss, loader)
+	})
+
+	var zero T
+	select {
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case result := <-results:
+		if result.Err != nil {
+			return zero, result.Err
+		}
+
+		// Hand each caller its own copy of the loaded value
+		var value T
+		if err := json.Unmarshal(result.Val.(encodedValue), &value); err != nil {
+			return zero, fmt.Errorf("failed to decode loaded value for %s: %w", key, err)
+		}
+		return value, nil
+	}
+}
+
+// reloadInBackground refreshes key unless a load is already in flight. The
+// caller has been served a cached value and does not wait.
+func reloadInBackground[T any](ctx context.Context, cs *CacheService, key string, ttl time.Duration, tags []string, reason string, loader func(ctx context.Context) (T, error)) {
+	cs.loads.DoChan(key, func() (interface{}, error) {
+		data, err := loadAndStore(ctx, cs, key, ttl, tags, reason, loader)
+		if err != nil {
+			cs.logger.WarnContext(ctx, "Background cache reload failed", "key", key, "reason", reason, "error", err)
+		}
+		return data, err
+	})
+}
+
+// loadAndStore runs loader and caches its result, returning it encoded.
+// Waiters share the load, so it is detached from the cancellation of the
+// caller that started it and bounded by CacheLoadTimeout instead.
+func loadAndStore[T any](ctx context.Context, cs *CacheService, key string, ttl time.Duration, tags []string, reason string, loader func(ctx context.Context) (T, error)) (encodedValue, error) {
+	loadCtx := context.WithoutCancel(ctx)
+	if cs.config.CacheLoadTimeout > 0 {
+		var cancel context.CancelFunc
+		loadCtx, cancel = context.WithTimeout(loadCtx, cs.config.CacheLoadTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	value, err := loader(loadCtx)
+	if err != nil {
+		recordCacheLoad(reason, false)
+		return nil, err
+	}
+	recordCacheLoad(reason, true)
+
+	entry := loadedEntry[T]{
+		Value:     value,
+		ExpiresAt: time.Now().Add(ttl).UnixMilli(),
+		LoadMs:    time.Since(start).Milliseconds(),
+	}
+	if err := cs.SetTagged(loadCtx, key, entry, ttl+cs.config.CacheStaleWhileRevalidate, tags); err != nil {
+		cs.logger.WarnContext(ctx, "Failed to cache loaded value", "key", key, "error", err)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode loaded value for %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// expiresEarly implements XFetch: a value is treated as expired when
+// now - loadTime * beta * ln(rand) passes its expiry, so reloads of values
+// that are slow to load start earlier. A beta of 0 disables it.
+func (cs *CacheService) expiresEarly(now, expiresAt time.Time, loadTime time.Duration) bool {
+	beta := cs.config.CacheXFetchBeta
+	if beta <= 0 || loadTime <= 0 {
+		return false
+	}
+
+	gap := time.Duration(-float64(loadTime) * beta * math.Log(1-rand.Float64()))
+	return !now.Add(gap).Before(expiresAt)
+}
+
+// recordCacheLoad counts a loader run by reason and outcome
+func recordCacheLoad(reason string, succeeded bool) {
+	outcome := metrics.LoadSucceeded
+	if !succeeded {
+		outcome = metrics.LoadFailed
+	}
+	metrics.CacheLoadsTotal.WithLabelValues(reason, outcome).Inc()
+}
\ No newline at end of file
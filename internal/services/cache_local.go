@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// cacheInvalidationChannel carries L1 invalidations between replicas
+const cacheInvalidationChannel = "cache:invalidate"
+
+// localEntry is a value held in the in-process L1 cache. Entries never
+// outlive the Redis key they were read from.
+type localEntry struct {
+	data      encodedValue
+	expiresAt time.Time
+}
+
+// cacheInvalidation tells replicas to drop L1 entries: the listed keys, or
+// everything on flush
+type cacheInvalidation struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys,omitempty"`
+	Flush  bool     `json:"flush,omitempty"`
+}
+
+// startLocal enables the L1 cache once this replica is subscribed to
+// invalidations. Without a subscription L1 stays off, since it could serve
+// values other replicas have changed.
+func (cs *CacheService) startLocal(ctx context.Context) {
+	pubsub := cs.redisClient.Subscribe(ctx, cs.key(cacheInvalidationChannel))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		cs.logger.WarnContext(ctx, "Failed to subscribe to cache invalidations, L1 cache disabled", "error", err)
+		return
+	}
+
+	cs.local = expirable.NewLRU(cs.config.CacheL1Size, func(key string, _ localEntry) {
+		cs.countEviction("l1", key)
+	}, cs.config.CacheL1TTL)
+	cs.invalidations = pubsub
+
+	cs.subscriber.Add(1)
+	go cs.receiveInvalidations(pubsub.Channel())
+}
+
+func (cs *CacheService) receiveInvalidations(messages <-chan *redis.Message) {
+	defer cs.subscriber.Done()
+
+	for message := range messages {
+		var invalidation cacheInvalidation
+		if err := json.Unmarshal([]byte(message.Payload), &invalidation); err != nil {
+			cs.logger.Warn("Ignoring malformed cache invalidation", "error", err)
+			continue
+		}
+		if invalidation.Origin == cs.config.InstanceID {
+			continue
+		}
+		cs.applyInvalidation(invalidation)
+	}
+}
+
+func (cs *CacheService) applyInvalidation(invalidation cacheInvalidation) {
+	if invalidation.Flush {
+		cs.removeExplicitly(cs.local.Purge)
+		return
+	}
+	cs.forgetLocal(invalidation.Keys...)
+}
+
+// invalidation builds a message telling other replicas to drop keys
+func (cs *CacheService) invalidation(keys ...string) cacheInvalidation {
+	return cacheInvalidation{Origin: cs.config.InstanceID, Keys: keys}
+}
+
+// publishInvalidation queues an invalidation on pipe, or publishes it
+// immediately when pipe is nil. It is a no-op while L1 is disabled.
+func (cs *CacheService) publishInvalidation(ctx context.Context, pipe redis.Pipeliner, invalidation cacheInvalidation) error {
+	if cs.local == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(invalidation)
+	if err != nil {
+		return err
+	}
+	if pipe != nil {
+		return pipe.Publish(ctx, cs.key(cacheInvalidationChannel), payload).Err()
+	}
+	return cs.redisClient.Publish(ctx, cs.key(cacheInvalidationChannel), payload).Err()
+}
+
+func (cs *CacheService) getLocal(key string) (encodedValue, bool) {
+	if cs.local == nil {
+		return nil, false
+	}
+
+	entry, ok := cs.local.Get(key)
+	if !ok {
+		cs.recordLookup("l1", key, false)
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		// Expired before the L1 TTL with its Redis key; counted as evicted
+		cs.local.Remove(key)
+		cs.recordLookup("l1", key, false)
+		return nil, false
+	}
+
+	cs.recordLookup("l1", key, true)
+	return entry.data, true
+}
+
+// setLocal holds data in L1 for at most the L1 TTL and never past ttl, the
+// remaining lifetime of the key in Redis (zero or negative for no expiry)
+func (cs *CacheService) setLocal(key string, data encodedValue, ttl time.Duration) {
+	if cs.local == nil {
+		return
+	}
+
+	if ttl <= 0 || ttl > cs.config.CacheL1TTL {
+		ttl = cs.config.CacheL1TTL
+	}
+
+	cs.removeMu.Lock()
+	defer cs.removeMu.Unlock()
+	cs.local.Add(key, localEntry{data: data, expiresAt: time.Now().Add(ttl)})
+}
+
+func (cs *CacheService) forgetLocal(keys ...string) {
+	if cs.local == nil {
+		return
+	}
+	cs.removeExplicitly(func() {
+		for _, key := range keys {
+			cs.local.Remove(key)
+		}
+	})
+}
\ No newline at end of file
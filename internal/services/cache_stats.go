@@ -0,0 +1,463 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"marketplace-app/internal/metrics"
+)
+
+// Cache operations whose latency is tracked
+const (
+	cacheOpGet    = "get"
+	cacheOpSet    = "set"
+	cacheOpDelete = "delete"
+)
+
+// latencySamples is how many recent samples each operation keeps for its
+// percentiles
+const latencySamples = 1024
+
+// TierStats counts lookups and evictions for one key prefix in one tier.
+// Evictions are entries the tier dropped on its own, to make room or on
+// expiry; deletes, invalidations and flushes are not counted. Redis
+// evictions are only reported server-wide, in the Redis stats.
+type TierStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// LatencyStats summarizes the recent latency of a cache operation in
+// milliseconds
+type LatencyStats struct {
+	Samples int     `json:"samples"`
+	P50     float64 `json:"p50_ms"`
+	P95     float64 `json:"p95_ms"`
+	P99     float64 `json:"p99_ms"`
+	Max     float64 `json:"max_ms"`
+}
+
+// RedisStats is the part of Redis INFO relevant to the cache. Memory and
+// eviction figures are for the whole server, which other applications may
+// share.
+type RedisStats struct {
+	UsedMemory         int64                    `json:"used_memory"`
+	UsedMemoryHuman    string                   `json:"used_memory_human"`
+	UsedMemoryPeak     int64                    `json:"used_memory_peak"`
+	MaxMemory          int64                    `json:"maxmemory"`
+	MaxMemoryPolicy    string                   `json:"maxmemory_policy"`
+	FragmentationRatio float64                  `json:"mem_fragmentation_ratio"`
+	KeyspaceHits       int64                    `json:"keyspace_hits"`
+	KeyspaceMisses     int64                    `json:"keyspace_misses"`
+	EvictedKeys        int64                    `json:"evicted_keys"`
+	ExpiredKeys        int64                    `json:"expired_keys"`
+	Keyspace           map[string]KeyspaceStats `json:"keyspace"`
+}
+
+// KeyspaceStats describes one Redis database
+type KeyspaceStats struct {
+	Keys    int64 `json:"keys"`
+	Expires int64 `json:"expires"`
+	AvgTTL  int64 `json:"avg_ttl_ms"`
+}
+
+// cacheStats holds the in-process counters behind GetStats
+type cacheStats struct {
+	mu sync.Mutex
+	// tiers maps key prefix, then tier, to its counters
+	tiers map[string]map[string]*TierStats
+
+	latency map[string]*latencyWindow
+}
+
+func newCacheStats() *cacheStats {
+	return &cacheStats{
+		tiers: make(map[string]map[string]*TierStats),
+		latency: map[string]*latencyWindow{
+			cacheOpGet:    {},
+			cacheOpSet:    {},
+			cacheOpDelete: {},
+		},
+	}
+}
+
+// count applies update to the counters of key's prefix in tier
+func (s *cacheStats) count(tier, prefix string, update func(*TierStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tiers, ok := s.tiers[prefix]
+	if !ok {
+		tiers = make(map[string]*TierStats)
+		s.tiers[prefix] = tiers
+	}
+	counters, ok := tiers[tier]
+	if !ok {
+		counters = &TierStats{}
+		tiers[tier] = counters
+	}
+	update(counters)
+}
+
+// prefixes returns a copy of the counters by key prefix and tier
+func (s *cacheStats) prefixes() map[string]map[string]TierStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]map[string]TierStats, len(s.tiers))
+	for prefix, tiers := range s.tiers {
+		snapshot[prefix] = make(map[string]TierStats, len(tiers))
+		for tier, counters := range tiers {
+			snapshot[prefix][tier] = *counters
+		}
+	}
+	return snapshot
+}
+
+// latencies returns the latency percentiles of each operation
+func (s *cacheStats) latencies() map[string]LatencyStats {
+	latencies := make(map[string]LatencyStats, len(s.latency))
+	for operation, window := range s.latency {
+		latencies[operation] = window.percentiles()
+	}
+	return latencies
+}
+
+// latencyWindow keeps the most recent latencies of an operation
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [latencySamples]time.Duration
+	next    int
+	count   int
+}
+
+func (w *latencyWindow) observe(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencySamples
+	if w.count < latencySamples {
+		w.count++
+	}
+}
+
+func (w *latencyWindow) percentiles() LatencyStats {
+	w.mu.Lock()
+	samples := make([]time.Duration, w.count)
+	copy(samples, w.samples[:w.count])
+	w.mu.Unlock()
+
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	at := func(p float64) float64 {
+		i := int(p*float64(len(samples))+0.5) - 1
+		if i < 0 {
+			i = 0
+		}
+		return float64(samples[i]) / float64(time.Millisecond)
+	}
+	return LatencyStats{
+		Samples: len(samples),
+		P50:     at(0.50),
+		P95:     at(0.95),
+		P99:     at(0.99),
+		Max:     at(1),
+	}
+}
+
+// keyPrefix returns the part of key before the first colon, which names the
+// kind of data it holds
+func keyPrefix(key string) string {
+	if i := strings.IndexByte(key, ':'); i > 0 {
+		return key[:i]
+	}
+	return "other"
+}
+
+// recordLookup counts a lookup of key against tier
+func (cs *CacheService) recordLookup(tier, key string, hit bool) {
+	prefix := keyPrefix(key)
+	result := metrics.CacheMiss
+	if hit {
+		result = metrics.CacheHit
+	}
+	metrics.CacheRequestsTotal.WithLabelValues(tier, result, prefix).Inc()
+
+	cs.stats.count(tier, prefix, func(counters *TierStats) {
+		if hit {
+			counters.Hits++
+		} else {
+			counters.Misses++
+		}
+	})
+}
+
+// recordLatency observes how long operation took since start
+func (cs *CacheService) recordLatency(operation string, start time.Time) {
+	elapsed := time.Since(start)
+	metrics.CacheOperationDuration.WithLabelValues(operation).Observe(elapsed.Seconds())
+	cs.stats.latency[operation].observe(elapsed)
+}
+
+// countEviction is called whenever tier drops key, and counts it unless it
+// was removed through removeExplicitly
+func (cs *CacheService) countEviction(tier, key string) {
+	if cs.removing.Load() {
+		return
+	}
+	prefix := keyPrefix(key)
+	metrics.CacheEvictionsTotal.WithLabelValues(tier, prefix).Inc()
+	cs.stats.count(tier, prefix, func(counters *TierStats) {
+		counters.Evictions++
+	})
+}
+
+// removeExplicitly runs remove without counting the entries it drops as
+// evictions. L1 writes take the same lock, so an entry evicted to make room
+// is never mistaken for an explicit removal.
+func (cs *CacheService) removeExplicitly(remove func()) {
+	cs.removeMu.Lock()
+	defer cs.removeMu.Unlock()
+
+	cs.removing.Store(true)
+	defer cs.removing.Store(false)
+	remove()
+}
+
+// deleteMemory deletes keys from the memory fallback
+func (cs *CacheService) deleteMemory(keys ...string) {
+	cs.removeExplicitly(func() {
+		for _, key := range keys {
+			cs.memoryCache.Delete(key)
+		}
+	})
+}
+
+// redisStats reads and parses the memory, stats and keyspace sections of
+// Redis INFO
+func (cs *CacheService) redisStats(ctx context.Context) (*RedisStats, error) {
+	sections := []string{"memory", "stats", "keyspace"}
+	cmds := make([]*redis.StringCmd, len(sections))
+	cs.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, section := range sections {
+			cmds[i] = pipe.Info(ctx, section)
+		}
+		return nil
+	})
+
+	info := make(map[string]string)
+	for _, cmd := range cmds {
+		text, err := cmd.Result()
+		if err != nil {
+			return nil, err
+		}
+		for field, value := range parseRedisInfo(text) {
+			info[field] = value
+		}
+	}
+
+	integer := func(field string) int64 {
+		n, _ := strconv.ParseInt(info[field], 10, 64)
+		return n
+	}
+	stats := &RedisStats{
+		UsedMemory:      integer("used_memory"),
+		UsedMemoryHuman: info["used_memory_human"],
+		UsedMemoryPeak:  integer("used_memory_peak"),
+		MaxMemory:       integer("maxmemory"),
+		MaxMemoryPolicy: info["maxmemory_policy"],
+		KeyspaceHits:    integer("keyspace_hits"),
+		KeyspaceMisses:  integer("keyspace_misses"),
+		EvictedKeys:     integer("evicted_keys"),
+		ExpiredKeys:     integer("expired_keys"),
+		Keyspace:        make(map[string]KeyspaceStats),
+	}
+	stats.FragmentationRatio, _ = strconv.ParseFloat(info["mem_fragmentation_ratio"], 64)
+
+	for field, value := range info {
+		if strings.HasPrefix(field, "db") {
+			stats.Keyspace[field] = parseKeyspace(value)
+		}
+	}
+	return stats, nil
+}
+
+// parseRedisInfo splits INFO output into its field:value lines
+func parseRedisInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if field, value, ok := strings.Cut(line, ":"); ok {
+			fields[field] = value
+		}
+	}
+	return fields
+}
+
+// parseKeyspace parses a keyspace line such as keys=10,expires=2,avg_ttl=500
+func parseKeyspace(value string) KeyspaceStats {
+	var stats KeyspaceStats
+	for _, pair := range strings.Split(value, ",") {
+		name, number, _ := strings.Cut(pair, "=")
+		n, _ := strconv.ParseInt(number, 10, 64)
+		switch name {
+		case "keys":
+			stats.Keys = n
+		case "expires":
+			stats.Expires = n
+		case "avg_ttl":
+			stats.AvgTTL = n
+		}
+	}
+	return stats
+}
+
+// KeyInspection reports where a cache key is held and what each tier has
+// stored for it
+type KeyInspection struct {
+	Key string `json:"key"`
+	// ServedBy is the tier a read would be answered from, empty if none
+	ServedBy string       `json:"served_by,omitempty"`
+	Tiers    []TierRecord `json:"tiers"`
+}
+
+// TierRecord is a key as held by one tier. TTL is in seconds, -1 when the
+// key never expires.
+type TierRecord struct {
+	Tier  string      `json:"tier"`
+	Found bool        `json:"found"`
+	Type  string      `json:"type,omitempty"`
+	TTL   float64     `json:"ttl_seconds,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Found reports whether any tier holds the key
+func (k *KeyInspection) Found() bool {
+	for _, record := range k.Tiers {
+		if record.Found {
+			return true
+		}
+	}
+	return false
+}
+
+// Inspect reports what each tier holds for key, for debugging stale reads.
+// Unlike a read it does not populate L1, refresh LRU order or count towards
+// the stats.
+func (cs *CacheService) Inspect(ctx context.Context, key string) (*KeyInspection, error) {
+	inspection := &KeyInspection{Key: key}
+
+	if cs.local != nil {
+		record := TierRecord{Tier: "l1"}
+		if entry, ok := cs.local.Peek(key); ok && time.Now().Before(entry.expiresAt) {
+			record.Found = true
+			record.TTL = time.Until(entry.expiresAt).Seconds()
+			record.Value = inspectedValue(entry.data)
+		}
+		inspection.Tiers = append(inspection.Tiers, record)
+	}
+
+	if cs.redisClient != nil {
+		record, err := cs.inspectRedis(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		inspection.Tiers = append(inspection.Tiers, record)
+	}
+
+	record := TierRecord{Tier: "memory"}
+	if value, expiresAt, found := cs.memoryCache.GetWithExpiration(key); found {
+		record.Found = true
+		record.TTL = -1
+		if !expiresAt.IsZero() {
+			record.TTL = time.Until(expiresAt).Seconds()
+		}
+		switch v := value.(type) {
+		case encodedValue:
+			record.Value = inspectedValue(v)
+		case memoryTag:
+			keys := make([]string, 0, len(v))
+			for member := range v {
+				keys = append(keys, member)
+			}
+			sort.Strings(keys)
+			record.Value = keys
+		default:
+			record.Value = v
+		}
+	}
+	inspection.Tiers = append(inspection.Tiers, record)
+
+	for _, record := range inspection.Tiers {
+		if record.Found {
+			inspection.ServedBy = record.Tier
+			break
+		}
+	}
+	return inspection, nil
+}
+
+func (cs *CacheService) inspectRedis(ctx context.Context, key string) (TierRecord, error) {
+	record := TierRecord{Tier: "redis"}
+
+	var keyType *redis.StatusCmd
+	var ttl *redis.DurationCmd
+	if _, err := cs.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		keyType = pipe.Type(ctx, cs.key(key))
+		ttl = pipe.PTTL(ctx, cs.key(key))
+		return nil
+	}); err != nil {
+		return record, err
+	}
+	if keyType.Val() == "none" {
+		return record, nil
+	}
+
+	record.Found = true
+	record.Type = keyType.Val()
+	record.TTL = -1
+	if ttl.Val() > 0 {
+		record.TTL = ttl.Val().Seconds()
+	}
+
+	switch record.Type {
+	case "string":
+		data, err := cs.redisClient.Get(ctx, cs.key(key)).Bytes()
+		if err != nil && err != redis.Nil {
+			return record, err
+		}
+		record.Value = inspectedValue(data)
+	case "set":
+		// Tag sets list the keys written with the tag
+		members, err := cs.redisClient.SMembers(ctx, cs.key(key)).Result()
+		if err != nil {
+			return record, err
+		}
+		sort.Strings(members)
+		record.Value = members
+	}
+	return record, nil
+}
+
+// inspectedValue returns stored data as JSON, or as a string when it is not
+// JSON, such as a counter written by another client
+func inspectedValue(data []byte) interface{} {
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	return string(data)
+}
\ No newline at end of file
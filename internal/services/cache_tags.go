@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// cacheTagTTL is the minimum lifetime of a tag's key set. Each tagged write
+// extends it, so a set outlives every entry it lists; keys that expired on
+// their own are simply skipped on invalidation.
+const cacheTagTTL = 24 * time.Hour
+
+// invalidateTagsScript deletes every key listed under the given tag sets,
+// and the sets themselves, returning the deleted keys. Sets list keys
+// without the namespace prefix, which is passed as ARGV[1]. Running it as one
+// script keeps a concurrent tagged write from slipping between read and delete.
+var invalidateTagsScript = redis.NewScript(`
+local deleted = {}
+for _, tag in ipairs(KEYS) do
+	local members = redis.call("SMEMBERS", tag)
+	for _, key in ipairs(members) do
+		redis.call("DEL", ARGV[1] .. key)
+		table.insert(deleted, key)
+	end
+	redis.call("DEL", tag)
+end
+return deleted
+`)
+
+// CompanyTag tags cache entries derived from a company's data
+func CompanyTag(companyID string) string {
+	return fmt.Sprintf("company:%s", companyID)
+}
+
+// LocationTag tags cache entries derived from a location's data
+func LocationTag(locationID string) string {
+	return fmt.Sprintf("location:%s", locationID)
+}
+
+func tagKey(tag string) string {
+	return fmt.Sprintf("tag:%s", tag)
+}
+
+// InvalidateTags deletes every entry written with any of the given tags, in
+// Redis or the memory fallback, and drops them from every replica's L1
+func (cs *CacheService) InvalidateTags(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	var deleted []string
+	if cs.redisClient != nil {
+		tagKeys := make([]string, len(tags))
+		for i, tag := range tags {
+			tagKeys[i] = cs.key(tagKey(tag))
+		}
+
+		var err error
+		deleted, err = invalidateTagsScript.Run(ctx, cs.redisClient, tagKeys, cs.config.CacheKeyPrefix).StringSlice()
+		if err != nil {
+			return fmt.Errorf("failed to invalidate cache tags: %w", err)
+		}
+
+		if len(deleted) > 0 {
+			cs.forgetLocal(deleted...)
+			if err := cs.publishInvalidation(ctx, nil, cs.invalidation(deleted...)); err != nil {
+				cs.logger.WarnContext(ctx, "Failed to publish cache invalidation", "tags", tags, "error", err)
+			}
+		}
+	}
+
+	// Entries written while Redis was unavailable are tagged in memory
+	cs.deleteMemory(cs.untagMemory(tags)...)
+
+	cs.logger.DebugContext(ctx, "Invalidated cache tags", "tags", tags, "keys", len(deleted))
+	return nil
+}
+
+// tagRedis records key under each tag on pipe
+func (cs *CacheService) tagRedis(ctx context.Context, pipe redis.Pipeliner, key string, expiration time.Duration, tags []string) {
+	if expiration < cacheTagTTL {
+		expiration = cacheTagTTL
+	}
+	for _, tag := range tags {
+		pipe.SAdd(ctx, cs.key(tagKey(tag)), key)
+		pipe.Expire(ctx, cs.key(tagKey(tag)), expiration)
+	}
+}
+
+// memoryTag is the set of memory fallback keys written with a tag
+type memoryTag map[string]struct{}
+
+// tagMemory records key under each tag in the memory fallback
+func (cs *CacheService) tagMemory(key string, expiration time.Duration, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	if expiration < cacheTagTTL {
+		expiration = cacheTagTTL
+	}
+
+	cs.tagsMu.Lock()
+	defer cs.tagsMu.Unlock()
+
+	for _, tag := range tags {
+		keys, _ := cs.memoryCache.Get(tagKey(tag))
+		set, ok := keys.(memoryTag)
+		if !ok {
+			set = make(memoryTag)
+		}
+		set[key] = struct{}{}
+		cs.memoryCache.Set(tagKey(tag), set, expiration)
+	}
+}
+
+// untagMemory removes the given tags from the memory fallback and returns
+// the keys they listed
+func (cs *CacheService) untagMemory(tags []string) []string {
+	cs.tagsMu.Lock()
+	defer cs.tagsMu.Unlock()
+
+	var keys []string
+	for _, tag := range tags {
+		value, _ := cs.memoryCache.Get(tagKey(tag))
+		if set, ok := value.(memoryTag); ok {
+			for key := range set {
+				keys = append(keys, key)
+			}
+		}
+		cs.deleteMemory(tagKey(tag))
+	}
+	return keys
+}
\ No newline at end of file
@@ -0,0 +1,435 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"marketplace-app/internal/config"
+	"marketplace-app/internal/models"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestCache returns a cache on the given Redis address; an L1 size of 0
+// disables the in-process tier
+func newTestCache(t *testing.T, redisAddr, instanceID string, l1Size int) *CacheService {
+	t.Helper()
+
+	cs := NewCacheService(&config.Config{
+		RedisURL:        "redis://" + redisAddr,
+		CacheExpiration: 5,
+		CacheKeyPrefix:  "test:",
+		InstanceID:      instanceID,
+		CacheL1Size:     l1Size,
+		CacheL1TTL:      time.Minute,
+		// Keep GetOrLoad entries around long enough to observe
+		CacheStaleWhileRevalidate: time.Minute,
+		CacheLoadTimeout:          time.Second,
+	}, testLogger)
+	t.Cleanup(cs.Close)
+	return cs
+}
+
+// newTestCaches returns a Redis-only cache and a cache with L1 on an
+// in-process Redis, and a memory-only cache whose Redis is unreachable
+func newTestCaches(t *testing.T) map[string]*CacheService {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	redisCache := newTestCache(t, mr.Addr(), "redis", 0)
+	if redisCache.redisClient == nil || redisCache.local != nil {
+		t.Fatal("expected Redis-backed cache without L1")
+	}
+
+	l1Cache := newTestCache(t, mr.Addr(), "l1", 100)
+	if l1Cache.local == nil {
+		t.Fatal("expected L1 to be enabled")
+	}
+
+	memoryCache := newTestCache(t, "127.0.0.1:1", "memory", 100)
+	if memoryCache.redisClient != nil || memoryCache.local != nil {
+		t.Fatal("expected memory-only cache without Redis")
+	}
+
+	return map[string]*CacheService{"redis": redisCache, "l1": l1Cache, "memory": memoryCache}
+}
+
+func TestGetJSONHit(t *testing.T) {
+	ctx := context.Background()
+
+	for tier, cs := range newTestCaches(t) {
+		t.Run(tier, func(t *testing.T) {
+			company := &models.Company{CompanyID: "company-1", CompanyName: "Acme"}
+			if err := SetJSON(ctx, cs, "company:company-1", company, time.Minute); err != nil {
+				t.Fatalf("SetJSON: %v", err)
+			}
+
+			got, ok := GetJSON[*models.Company](ctx, cs, "company:company-1")
+			if !ok {
+				t.Fatal("expected a cache hit for *models.Company")
+			}
+			if got.CompanyID != company.CompanyID || got.CompanyName != company.CompanyName {
+				t.Errorf("got company %+v, want %+v", got, company)
+			}
+			if got == company {
+				t.Error("expected a decoded copy, not the cached pointer")
+			}
+
+			locations := []models.Location{{LocationID: "loc-1"}, {LocationID: "loc-2"}}
+			if err := SetJSON(ctx, cs, "locations:company-1", locations, time.Minute); err != nil {
+				t.Fatalf("SetJSON: %v", err)
+			}
+			gotLocations, ok := GetJSON[[]models.Location](ctx, cs, "locations:company-1")
+			if !ok {
+				t.Fatal("expected a cache hit for []models.Location")
+			}
+			if len(gotLocations) != 2 || gotLocations[1].LocationID != "loc-2" {
+				t.Errorf("got locations %+v, want %+v", gotLocations, locations)
+			}
+
+			if err := SetJSON(ctx, cs, "state:abc", "company-1", time.Minute); err != nil {
+				t.Fatalf("SetJSON: %v", err)
+			}
+			if got, ok := GetJSON[string](ctx, cs, "state:abc"); !ok || got != "company-1" {
+				t.Errorf("got string %q (found %v), want %q", got, ok, "company-1")
+			}
+		})
+	}
+}
+
+func TestGetJSONMiss(t *testing.T) {
+	ctx := context.Background()
+
+	for tier, cs := range newTestCaches(t) {
+		t.Run(tier, func(t *testing.T) {
+			if _, ok := GetJSON[*models.Company](ctx, cs, "company:missing"); ok {
+				t.Error("expected a miss for an unknown key")
+			}
+
+			// A value of another shape must not decode into the requested type
+			if err := SetJSON(ctx, cs, "company:wrong-type", "not a company", time.Minute); err != nil {
+				t.Fatalf("SetJSON: %v", err)
+			}
+			if _, ok := GetJSON[*models.Company](ctx, cs, "company:wrong-type"); ok {
+				t.Error("expected a miss for a value of another type")
+			}
+		})
+	}
+}
+
+func TestL1InvalidatedAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	writer := newTestCache(t, mr.Addr(), "replica-a", 100)
+	reader := newTestCache(t, mr.Addr(), "replica-b", 100)
+
+	key := "company:company-1"
+	if err := SetJSON(ctx, writer, key, "v1", time.Minute); err != nil {
+		t.Fatalf("SetJSON: %v", err)
+	}
+	if got, ok := GetJSON[string](ctx, reader, key); !ok || got != "v1" {
+		t.Fatalf("got %q (found %v), want v1", got, ok)
+	}
+	if _, ok := reader.getLocal(key); !ok {
+		t.Fatal("expected the read to populate the reader's L1")
+	}
+
+	if err := SetJSON(ctx, writer, key, "v2", time.Minute); err != nil {
+		t.Fatalf("SetJSON: %v", err)
+	}
+	waitFor(t, "reader to see v2", func() bool {
+		got, _ := GetJSON[string](ctx, reader, key)
+		return got == "v2"
+	})
+
+	writer.Delete(ctx, key)
+	waitFor(t, "reader to see the delete", func() bool {
+		_, ok := GetJSON[string](ctx, reader, key)
+		return !ok
+	})
+}
+
+func TestGetOrLoadSharesConcurrentLoads(t *testing.T) {
+	ctx := context.Background()
+
+	for tier, cs := range newTestCaches(t) {
+		// The Redis-backed caches share a server, so each tier loads its own key
+		key := "locations:" + tier
+		t.Run(tier, func(t *testing.T) {
+			var loads atomic.Int32
+			release := make(chan struct{})
+			loader := func(ctx context.Context) ([]models.Location, error) {
+				loads.Add(1)
+				<-release
+				return []models.Location{{LocationID: "loc-1"}}, nil
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					locations, err := GetOrLoad(ctx, cs, key, time.Minute, nil, loader)
+					if err != nil || len(locations) != 1 {
+						t.Errorf("got %+v, %v; want one location", locations, err)
+					}
+				}()
+			}
+
+			// Let the callers queue up behind the first load
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if got := loads.Load(); got != 1 {
+				t.Errorf("loader ran %d times, want 1", got)
+			}
+
+			// Later reads are served from the cache
+			if _, err := GetOrLoad(ctx, cs, key, time.Minute, nil, loader); err != nil {
+				t.Fatalf("GetOrLoad: %v", err)
+			}
+			if got := loads.Load(); got != 1 {
+				t.Errorf("loader ran %d times after a cached read, want 1", got)
+			}
+		})
+	}
+}
+
+func TestGetOrLoadServesStaleWhileReloading(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	cs := newTestCache(t, mr.Addr(), "stale", 0)
+
+	// An entry whose TTL has passed but which is still within the stale window
+	expired := loadedEntry[string]{Value: "stale", ExpiresAt: time.Now().Add(-time.Second).UnixMilli()}
+	if err := cs.Set(ctx, "company:stale", expired, time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	loader := func(ctx context.Context) (string, error) { return "fresh", nil }
+	got, err := GetOrLoad(ctx, cs, "company:stale", time.Minute, nil, loader)
+	if err != nil || got != "stale" {
+		t.Fatalf("got %q, %v; want the stale value", got, err)
+	}
+
+	waitFor(t, "the background reload", func() bool {
+		got, _ := GetOrLoad(ctx, cs, "company:stale", time.Minute, nil, loader)
+		return got == "fresh"
+	})
+}
+
+func TestInvalidateTags(t *testing.T) {
+	ctx := context.Background()
+
+	for tier, cs := range newTestCaches(t) {
+		t.Run(tier, func(t *testing.T) {
+			companyTag, locationTag := CompanyTag(tier), LocationTag(tier+"-loc")
+			entries := map[string][]string{
+				"company:" + tier:           {companyTag},
+				"locations:" + tier:         {companyTag},
+				"contacts:" + tier:          {locationTag},
+				"unrelated:" + tier:         nil,
+				"location:" + tier + "-loc": {locationTag},
+			}
+			for key, tags := range entries {
+				if err := cs.SetTagged(ctx, key, "value", time.Minute, tags); err != nil {
+					t.Fatalf("SetTagged %s: %v", key, err)
+				}
+			}
+
+			if err := cs.InvalidateTags(ctx, companyTag); err != nil {
+				t.Fatalf("InvalidateTags: %v", err)
+			}
+			for key, tags := range entries {
+				_, found := GetJSON[string](ctx, cs, key)
+				tagged := len(tags) > 0 && tags[0] == companyTag
+				if found == tagged {
+					t.Errorf("%s: found %v after invalidating %s", key, found, companyTag)
+				}
+			}
+
+			if err := cs.InvalidateTags(ctx, locationTag); err != nil {
+				t.Fatalf("InvalidateTags: %v", err)
+			}
+			if _, found := GetJSON[string](ctx, cs, "contacts:"+tier); found {
+				t.Errorf("contacts entry survived invalidating %s", locationTag)
+			}
+			if _, found := GetJSON[string](ctx, cs, "unrelated:"+tier); !found {
+				t.Error("untagged entry was invalidated")
+			}
+		})
+	}
+}
+
+func TestRemoveReportsOnce(t *testing.T) {
+	ctx := context.Background()
+
+	for tier, cs := range newTestCaches(t) {
+		t.Run(tier, func(t *testing.T) {
+			key := "alert_active:" + tier
+			if err := cs.Set(ctx, key, "warning", time.Minute); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+
+			var removed atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if ok, err := cs.Remove(ctx, key); err == nil && ok {
+						removed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if removed.Load() != 1 {
+				t.Errorf("%d removers were told they removed the key, want 1", removed.Load())
+			}
+			if cs.Exists(ctx, key) {
+				t.Error("key still exists after Remove")
+			}
+		})
+	}
+}
+
+func TestFlushStaysInNamespace(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	cs := newTestCache(t, mr.Addr(), "flush", 0)
+
+	// Another application's key on the same Redis, and a held lock
+	mr.Set("other-app:session", "keep")
+	mr.Set("test:lock:scheduler:token_refresh", "keep")
+
+	cs.Set(ctx, "company:1", "a", time.Minute)
+	cs.Set(ctx, "products:loc-1", "b", time.Minute)
+	cs.Set(ctx, "oauth_state:xyz", "company-1", time.Minute)
+	cs.Increment(ctx, "rate_limit:ip:1.2.3.4", 1)
+
+	result, err := cs.Flush(ctx, true, CacheCategoryBusiness)
+	if err != nil {
+		t.Fatalf("Flush dry run: %v", err)
+	}
+	if result.Total != 2 || result.Categories[CacheCategoryBusiness] != 2 {
+		t.Errorf("dry run counted %+v, want 2 business keys", result)
+	}
+	if !mr.Exists("test:company:1") {
+		t.Fatal("dry run deleted a key")
+	}
+
+	if _, err := cs.Flush(ctx, false, CacheCategoryBusiness); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	for _, key := range []string{"test:company:1", "test:products:loc-1"} {
+		if mr.Exists(key) {
+			t.Errorf("%s survived the business flush", key)
+		}
+	}
+	if !mr.Exists("test:oauth_state:xyz") {
+		t.Error("business flush deleted OAuth state")
+	}
+
+	result, err = cs.Flush(ctx, false)
+	if err != nil {
+		t.Fatalf("Flush all: %v", err)
+	}
+	if result.Total != 2 {
+		t.Errorf("flushed %d keys, want the OAuth state and rate limit counter", result.Total)
+	}
+	for _, key := range []string{"other-app:session", "test:lock:scheduler:token_refresh"} {
+		if !mr.Exists(key) {
+			t.Errorf("%s was flushed", key)
+		}
+	}
+
+	if _, err := cs.Flush(ctx, true, "everything"); !errors.Is(err, ErrUnknownCacheCategory) {
+		t.Errorf("got %v for an unknown category, want ErrUnknownCacheCategory", err)
+	}
+}
+
+func TestStatsAndInspect(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	cs := newTestCache(t, mr.Addr(), "stats", 2)
+
+	cs.Set(ctx, "company:1", "acme", time.Minute)
+	GetJSON[string](ctx, cs, "company:1")
+	GetJSON[string](ctx, cs, "company:missing")
+	GetJSON[string](ctx, cs, "products:loc-1")
+
+	prefixes := cs.stats.prefixes()
+	if got := prefixes["company"]["l1"]; got.Hits != 1 || got.Misses != 1 {
+		t.Errorf("company l1 stats %+v, want 1 hit and 1 miss", got)
+	}
+	if got := prefixes["products"]["redis"]; got.Misses != 1 {
+		t.Errorf("products redis stats %+v, want 1 miss", got)
+	}
+
+	// Filling L1 past its size evicts, deleting does not
+	cs.Set(ctx, "contacts:1", "a", time.Minute)
+	cs.Set(ctx, "contacts:2", "b", time.Minute)
+	cs.Delete(ctx, "contacts:2")
+	prefixes = cs.stats.prefixes()
+	if got := prefixes["company"]["l1"].Evictions; got != 1 {
+		t.Errorf("company l1 evictions %d, want 1", got)
+	}
+	if got := prefixes["contacts"]["l1"].Evictions; got != 0 {
+		t.Errorf("contacts l1 evictions %d after a delete, want 0", got)
+	}
+	if got := cs.stats.latencies()[cacheOpGet].Samples; got != 3 {
+		t.Errorf("got %d get latency samples, want 3", got)
+	}
+
+	inspection, err := cs.Inspect(ctx, "contacts:1")
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if inspection.ServedBy != "l1" || len(inspection.Tiers) != 3 {
+		t.Fatalf("got %+v, want contacts:1 served by l1", inspection)
+	}
+	redisRecord := inspection.Tiers[1]
+	if !redisRecord.Found || redisRecord.Type != "string" || redisRecord.TTL <= 0 {
+		t.Errorf("got Redis record %+v, want a string with a TTL", redisRecord)
+	}
+
+	inspection, err = cs.Inspect(ctx, "contacts:2")
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if inspection.Found() {
+		t.Errorf("got %+v for a deleted key", inspection)
+	}
+}
+
+func TestParseRedisInfo(t *testing.T) {
+	info := parseRedisInfo("# Memory\r\nused_memory:1024\r\nmaxmemory_policy:allkeys-lru\r\n\r\n# Keyspace\r\ndb0:keys=10,expires=2,avg_ttl=500\r\n")
+	if info["used_memory"] != "1024" || info["maxmemory_policy"] != "allkeys-lru" {
+		t.Errorf("got %v", info)
+	}
+	if got := parseKeyspace(info["db0"]); got != (KeyspaceStats{Keys: 10, Expires: 2, AvgTTL: 500}) {
+		t.Errorf("got keyspace %+v", got)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"marketplace-app/internal/config"
+)
+
+// Component health statuses
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusDegraded  = "degraded"
+	HealthStatusUnhealthy = "unhealthy"
+)
+
+// goHighLevelAPIURL is probed to check GoHighLevel reachability
+const goHighLevelAPIURL = "https://services.leadconnectorhq.com"
+
+// ComponentHealth is the result of checking one dependency
+type ComponentHealth struct {
+	Name      string                 `json:"name"`
+	Healthy   bool                   `json:"healthy"`
+	Status    string                 `json:"status"`
+	LatencyMs float64                `json:"latency_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	CheckedAt time.Time              `json:"checked_at"`
+}
+
+// HealthService checks the database, cache and upstream providers for
+// health endpoints and readiness probes
+type HealthService struct {
+	db       *gorm.DB
+	cache    *CacheService
+	upstream *UpstreamClient
+	timeout  time.Duration
+	cacheTTL time.Duration
+	client   *http.Client
+	// probes maps each upstream provider to the URL checked for reachability
+	probes map[string]string
+
+	// upstream results are cached so probes do not call providers on every request
+	mu          sync.Mutex
+	probeMu     sync.Mutex
+	upstreamAt  time.Time
+	upstreamRes []ComponentHealth
+}
+
+func NewHealthService(db *gorm.DB, cache *CacheService, upstream *UpstreamClient, cfg *config.Config) *HealthService {
+	return &HealthService{
+		db:       db,
+		cache:    cache,
+		upstream: upstream,
+		timeout:  cfg.HealthCheckTimeout,
+		cacheTTL: cfg.HealthUpstreamCacheTTL,
+		client:   &http.Client{Timeout: cfg.HealthCheckTimeout},
+		probes: map[string]string{
+			ProviderNango:       cfg.NangoServerURL,
+			ProviderGoHighLevel: goHighLevelAPIURL,
+		},
+	}
+}
+
+// CheckDatabase pings the database and reports connection pool statistics.
+// The pool is reported as degraded when every connection is in use and
+// requests are waiting for one.
+func (hs *HealthService) CheckDatabase(ctx context.Context) ComponentHealth {
+	health := ComponentHealth{Name: "database", CheckedAt: time.Now()}
+	if hs.db == nil {
+		return unhealthy(health, fmt.Errorf("database not configured"))
+	}
+
+	sqlDB, err := hs.db.DB()
+	if err != nil {
+		return unhealthy(health, fmt.Errorf("failed to get underlying sql.DB: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hs.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err = sqlDB.PingContext(ctx)
+	health.LatencyMs = millis(time.Since(start))
+
+	stats := sqlDB.Stats()
+	health.Details = map[string]interface{}{
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"max_open_connections": stats.MaxOpenConnections,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     millis(stats.WaitDuration),
+	}
+
+	if err != nil {
+		return unhealthy(health, fmt.Errorf("database ping failed: %w", err))
+	}
+
+	health.Healthy = true
+	health.Status = HealthStatusHealthy
+	if stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections {
+		health.Status = HealthStatusDegraded
+	}
+	return health
+}
+
+// CheckCache pings Redis. Without Redis the service runs on its in-memory
+// cache alone, which is reported as degraded rather than unhealthy.
+func (hs *HealthService) CheckCache(ctx context.Context) ComponentHealth {
+	health := ComponentHealth{Name: "cache", CheckedAt: time.Now()}
+	if hs.cache == nil {
+		return unhealthy(health, fmt.Errorf("cache not configured"))
+	}
+
+	if hs.cache.redisClient == nil {
+		health.Healthy = true
+		health.Status = HealthStatusDegraded
+		health.Details = map[string]interface{}{"mode": "memory"}
+		return health
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hs.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := hs.cache.redisClient.Ping(ctx).Err()
+	health.LatencyMs = millis(time.Since(start))
+
+	poolStats := hs.cache.redisClient.PoolStats()
+	health.Details = map[string]interface{}{
+		"mode":        "redis",
+		"total_conns": poolStats.TotalConns,
+		"idle_conns":  poolStats.IdleConns,
+		"timeouts":    poolStats.Timeouts,
+	}
+	if hs.cache.local != nil {
+		health.Details["l1_items"] = hs.cache.local.Len()
+	}
+
+	if err != nil {
+		return unhealthy(health, fmt.Errorf("redis ping failed: %w", err))
+	}
+
+	health.Healthy = true
+	health.Status = HealthStatusHealthy
+	return health
+}
+
+// CheckUpstream reports whether each provider is reachable. Results are
+// cached for the configured TTL; any HTTP response counts as reachable, and
+// a provider whose circuit breaker is open is reported as degraded.
+func (hs *HealthService) CheckUpstream(ctx context.Context) []ComponentHealth {
+	if cached, ok := hs.cachedUpstream(); ok {
+		return cached
+	}
+
+	// Only one caller probes at a time; the rest wait and reuse its result
+	hs.probeMu.Lock()
+	defer hs.probeMu.Unlock()
+	if cached, ok := hs.cachedUpstream(); ok {
+		return cached
+	}
+
+	breakers := make(map[string]CircuitBreakerStats)
+	if hs.upstream != nil {
+		for _, stats := range hs.upstream.BreakerStats() {
+			breakers[stats.Provider] = stats
+		}
+	}
+
+	results := make([]ComponentHealth, 0, len(hs.probes))
+	for _, provider := range []string{ProviderNango, ProviderGoHighLevel} {
+		health := hs.probe(ctx, provider, hs.probes[provider])
+		if stats, ok := breakers[provider]; ok {
+			health.Details["circuit_breaker"] = stats.State
+			if health.Healthy && stats.State != CircuitClosed {
+				health.Status = HealthStatusDegraded
+			}
+		}
+		results = append(results, health)
+	}
+
+	hs.mu.Lock()
+	hs.upstreamRes = results
+	hs.upstreamAt = time.Now()
+	hs.mu.Unlock()
+
+	return results
+}
+
+// Private helper methods
+
+func (hs *HealthService) cachedUpstream() ([]ComponentHealth, bool) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if hs.upstreamRes == nil || time.Since(hs.upstreamAt) > hs.cacheTTL {
+		return nil, false
+	}
+	return hs.upstreamRes, true
+}
+
+func (hs *HealthService) probe(ctx context.Context, provider, url string) ComponentHealth {
+	health := ComponentHealth{
+		Name:      provider,
+		CheckedAt: time.Now(),
+		Details:   map[string]interface{}{"url": url},
+	}
+
+	// Probe on a context detached from the caller so a cancelled request
+	// does not cache the provider as unreachable
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), hs.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return unhealthy(health, fmt.Errorf("failed to create probe request: %w", err))
+	}
+
+	start := time.Now()
+	resp, err := hs.client.Do(req)
+	health.LatencyMs = millis(time.Since(start))
+	if err != nil {
+		return unhealthy(health, fmt.Errorf("%s unreachable: %w", provider, err))
+	}
+	resp.Body.Close()
+
+	health.Details["status_code"] = resp.StatusCode
+	health.Healthy = true
+	health.Status = HealthStatusHealthy
+	if resp.StatusCode >= 500 {
+		health.Status = HealthStatusDegraded
+	}
+	return health
+}
+
+func unhealthy(health ComponentHealth, err error) ComponentHealth {
+	health.Healthy = false
+	health.Status = HealthStatusUnhealthy
+	health.Error = err.Error()
+	return health
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
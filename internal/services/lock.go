@@ -0,0 +1,423 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"marketplace-app/internal/models"
+)
+
+var (
+	// ErrLockHeld is returned when a lock is currently held by another owner
+	ErrLockHeld = errors.New("lock is held by another instance")
+	// ErrLockLost is returned when renewing a lock whose lease has already
+	// expired, and may since have been taken by another owner
+	ErrLockLost = errors.New("lock lease was lost")
+)
+
+// releaseLockScript deletes the lock key only if it still holds our value
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// renewLockScript extends the lock key's expiry only if it still holds our value
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+const (
+	lockBackendRedis    = "redis"
+	lockBackendPostgres = "postgres"
+)
+
+// lockPollInterval is how often Acquire retries a held lock
+const lockPollInterval = 100 * time.Millisecond
+
+// LockService provides cross-instance locks so that work such as scheduled
+// jobs runs on exactly one replica. A single backend is authoritative for
+// every lock: leases in the Postgres distributed_locks table when a database
+// is configured, and Redis SET NX PX keys only without one. Locks never
+// switch backends on an error, since two replicas on different backends would
+// both hold the same lock. Leases are used rather than advisory locks because
+// an advisory lock lives in a database session, and would keep a pooled
+// connection checked out for as long as it is held.
+type LockService struct {
+	redisClient *redis.Client
+	keyPrefix   string
+	db          *gorm.DB
+	instanceID  string
+	logger      *slog.Logger
+
+	mu   sync.Mutex
+	held map[string]*Lock
+}
+
+// Lock is a lease on a named lock held by this instance
+type Lock struct {
+	Name       string
+	Owner      string
+	Backend    string
+	AcquiredAt time.Time
+	ExpiresAt  time.Time
+
+	value   string
+	release sync.Once
+}
+
+// LockInfo describes the current holder of a lock
+type LockInfo struct {
+	Name           string     `json:"name"`
+	Holder         string     `json:"holder,omitempty"`
+	Backend        string     `json:"backend,omitempty"`
+	AcquiredAt     *time.Time `json:"acquired_at,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	Held           bool       `json:"held"`
+	HeldByInstance bool       `json:"held_by_this_instance"`
+}
+
+// lockValue is the payload stored in Redis for a held lock
+type lockValue struct {
+	Owner      string    `json:"owner"`
+	Token      string    `json:"token"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+func NewLockService(cache *CacheService, db *gorm.DB, instanceID string, logger *slog.Logger) *LockService {
+	var redisClient *redis.Client
+	var keyPrefix string
+	if cache != nil {
+		redisClient = cache.redisClient
+		keyPrefix = cache.config.CacheKeyPrefix
+	}
+
+	return &LockService{
+		redisClient: redisClient,
+		keyPrefix:   keyPrefix,
+		db:          db,
+		instanceID:  instanceID,
+		logger:      logger,
+		held:        make(map[string]*Lock),
+	}
+}
+
+// InstanceID returns the identifier this instance uses as lock owner
+func (ls *LockService) InstanceID() string {
+	return ls.instanceID
+}
+
+// TryAcquire attempts to take the named lock for the given lease duration.
+// It returns ErrLockHeld if another owner currently holds the lock. The lease
+// expires on its own after ttl unless renewed with Renew or released earlier
+// with Release.
+func (ls *LockService) TryAcquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	switch ls.backend() {
+	case lockBackendPostgres:
+		return ls.acquirePostgres(ctx, name, ttl)
+	case lockBackendRedis:
+		return ls.acquireRedis(ctx, name, ttl)
+	default:
+		return nil, fmt.Errorf("no lock backend available for %s", name)
+	}
+}
+
+// Acquire takes the named lock, waiting up to wait for the current holder to
+// release it. It returns ErrLockHeld if the lock is still held after waiting.
+func (ls *LockService) Acquire(ctx context.Context, name string, ttl, wait time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		lock, err := ls.TryAcquire(ctx, name, ttl)
+		if !errors.Is(err, ErrLockHeld) || time.Now().After(deadline) {
+			return lock, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Renew extends a held lock's lease to ttl from now. It returns ErrLockLost
+// if the lease expired first.
+func (ls *LockService) Renew(ctx context.Context, lock *Lock, ttl time.Duration) error {
+	var renewed bool
+	switch lock.Backend {
+	case lockBackendRedis:
+		n, err := renewLockScript.Run(ctx, ls.redisClient, []string{ls.lockKey(lock.Name)}, lock.value, ttl.Milliseconds()).Int()
+		if err != nil {
+			return fmt.Errorf("failed to renew lock %s: %w", lock.Name, err)
+		}
+		renewed = n == 1
+	case lockBackendPostgres:
+		result := ls.db.WithContext(ctx).Exec(`
+			UPDATE distributed_locks SET expires_at = now() + ? * interval '1 millisecond'
+			WHERE name = ? AND token = ? AND expires_at > now()`,
+			ttl.Milliseconds(), lock.Name, lock.value)
+		if result.Error != nil {
+			return fmt.Errorf("failed to renew lock %s: %w", lock.Name, result.Error)
+		}
+		renewed = result.RowsAffected == 1
+	}
+	if !renewed {
+		return fmt.Errorf("%w: %s", ErrLockLost, lock.Name)
+	}
+
+	ls.mu.Lock()
+	lock.ExpiresAt = time.Now().Add(ttl)
+	ls.mu.Unlock()
+	return nil
+}
+
+// Hold renews lock every third of ttl until the returned stop function is
+// called. The returned context is cancelled if the lease is lost, so work
+// guarded by the lock stops before another owner can start it.
+func (ls *LockService) Hold(ctx context.Context, lock *Lock, ttl time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := ls.Renew(ctx, lock, ttl)
+			if errors.Is(err, ErrLockLost) {
+				ls.logger.ErrorContext(ctx, "Lost lock while holding it, cancelling its work", "lock", lock.Name)
+				cancel()
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				// The lease outlasts a few failed renewals; keep trying
+				ls.logger.WarnContext(ctx, "Failed to renew lock", "lock", lock.Name, "error", err)
+			}
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		<-done
+	}
+}
+
+// Release gives up a lock before its lease expires
+func (ls *LockService) Release(ctx context.Context, lock *Lock) error {
+	if lock == nil {
+		return nil
+	}
+
+	var err error
+	lock.release.Do(func() {
+		ls.mu.Lock()
+		if ls.held[lock.Name] == lock {
+			delete(ls.held, lock.Name)
+		}
+		ls.mu.Unlock()
+
+		switch lock.Backend {
+		case lockBackendRedis:
+			err = releaseLockScript.Run(ctx, ls.redisClient, []string{ls.lockKey(lock.Name)}, lock.value).Err()
+		case lockBackendPostgres:
+			// Only our own lease is deleted; a lease that expired and was
+			// claimed by another instance is left alone
+			err = ls.db.WithContext(ctx).
+				Where("name = ? AND token = ?", lock.Name, lock.value).
+				Delete(&models.DistributedLock{}).Error
+		}
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", lock.Name, err)
+	}
+	return nil
+}
+
+// Holder reports who currently holds the named lock
+func (ls *LockService) Holder(ctx context.Context, name string) LockInfo {
+	info := LockInfo{Name: name}
+
+	ls.mu.Lock()
+	lock, ok := ls.held[name]
+	var acquiredAt, expiresAt time.Time
+	if ok {
+		acquiredAt, expiresAt = lock.AcquiredAt, lock.ExpiresAt
+	}
+	ls.mu.Unlock()
+
+	if ok && time.Now().Before(expiresAt) {
+		info.Held = true
+		info.HeldByInstance = true
+		info.Holder = lock.Owner
+		info.Backend = lock.Backend
+		info.AcquiredAt = &acquiredAt
+		info.ExpiresAt = &expiresAt
+		return info
+	}
+
+	switch ls.backend() {
+	case lockBackendPostgres:
+		return ls.holderPostgres(ctx, info)
+	case lockBackendRedis:
+		return ls.holderRedis(ctx, info)
+	default:
+		return info
+	}
+}
+
+// Private helper methods
+
+// backend is the lock backend authoritative for every lock
+func (ls *LockService) backend() string {
+	switch {
+	case ls.db != nil:
+		return lockBackendPostgres
+	case ls.redisClient != nil:
+		return lockBackendRedis
+	default:
+		return ""
+	}
+}
+
+// holderRedis fills in info from the lock's Redis key, if set
+func (ls *LockService) holderRedis(ctx context.Context, info LockInfo) LockInfo {
+	key := ls.lockKey(info.Name)
+	raw, err := ls.redisClient.Get(ctx, key).Result()
+	if err != nil {
+		return info
+	}
+
+	var value lockValue
+	if json.Unmarshal([]byte(raw), &value) != nil {
+		return info
+	}
+
+	info.Held = true
+	info.Holder = value.Owner
+	info.Backend = lockBackendRedis
+	info.HeldByInstance = value.Owner == ls.instanceID
+	info.AcquiredAt = &value.AcquiredAt
+	if ttl, err := ls.redisClient.PTTL(ctx, key).Result(); err == nil && ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		info.ExpiresAt = &expiresAt
+	}
+
+	return info
+}
+
+func (ls *LockService) acquireRedis(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	now := time.Now()
+	payload, err := json.Marshal(lockValue{
+		Owner:      ls.instanceID,
+		Token:      uuid.New().String(),
+		AcquiredAt: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode lock value: %w", err)
+	}
+
+	ok, err := ls.redisClient.SetNX(ctx, ls.lockKey(name), payload, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockHeld
+	}
+
+	lock := &Lock{
+		Name:       name,
+		Owner:      ls.instanceID,
+		Backend:    lockBackendRedis,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+		value:      string(payload),
+	}
+	ls.track(lock)
+
+	return lock, nil
+}
+
+// acquirePostgres claims the lease row of a lock, inserting it or taking
+// it over once expired. Expiry is judged by the database clock, so replicas
+// with skewed clocks agree on it.
+func (ls *LockService) acquirePostgres(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	token := uuid.New().String()
+	result := ls.db.WithContext(ctx).Exec(`
+		INSERT INTO distributed_locks (name, holder, token, acquired_at, expires_at)
+		VALUES (?, ?, ?, now(), now() + ? * interval '1 millisecond')
+		ON CONFLICT (name) DO UPDATE SET
+			holder = EXCLUDED.holder,
+			token = EXCLUDED.token,
+			acquired_at = EXCLUDED.acquired_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE distributed_locks.expires_at <= now()`,
+		name, ls.instanceID, token, ttl.Milliseconds())
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to claim lock lease: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrLockHeld
+	}
+
+	now := time.Now()
+	lock := &Lock{
+		Name:       name,
+		Owner:      ls.instanceID,
+		Backend:    lockBackendPostgres,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+		value:      token,
+	}
+	ls.track(lock)
+
+	return lock, nil
+}
+
+// holderPostgres fills in info from an unexpired lease row, if any
+func (ls *LockService) holderPostgres(ctx context.Context, info LockInfo) LockInfo {
+	if ls.db == nil {
+		return info
+	}
+
+	var lease models.DistributedLock
+	if err := ls.db.WithContext(ctx).Where("name = ? AND expires_at > now()", info.Name).First(&lease).Error; err != nil {
+		return info
+	}
+
+	info.Held = true
+	info.Holder = lease.Holder
+	info.Backend = lockBackendPostgres
+	info.HeldByInstance = lease.Holder == ls.instanceID
+	info.AcquiredAt = &lease.AcquiredAt
+	info.ExpiresAt = &lease.ExpiresAt
+	return info
+}
+
+func (ls *LockService) track(lock *Lock) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.held[lock.Name] = lock
+}
+
+// lockKey is the Redis key of a lock, in the cache's key namespace
+func (ls *LockService) lockKey(name string) string {
+	return fmt.Sprintf("%slock:%s", ls.keyPrefix, name)
+}
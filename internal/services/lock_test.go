@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestLockRenewRedis(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	ls := NewLockService(newTestCache(t, mr.Addr(), "locks", 0), nil, "instance-a", testLogger)
+	other := NewLockService(newTestCache(t, mr.Addr(), "locks", 0), nil, "instance-b", testLogger)
+
+	lock, err := ls.TryAcquire(ctx, "job", time.Second)
+	if err != nil {
+		t.Fatalf("TryAcquire: %v", err)
+	}
+	if _, err := other.TryAcquire(ctx, "job", time.Second); !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("got %v, want ErrLockHeld", err)
+	}
+
+	// Renewing restores the full lease
+	mr.FastForward(800 * time.Millisecond)
+	if err := ls.Renew(ctx, lock, time.Second); err != nil {
+		t.Fatalf("Renew: %v", err)
+	}
+	if ttl := mr.TTL("test:lock:job"); ttl != time.Second {
+		t.Errorf("got TTL %v, want the lease renewed to 1s", ttl)
+	}
+
+	// A lease that expired, even if taken over since, cannot be renewed
+	mr.FastForward(2 * time.Second)
+	if _, err := other.TryAcquire(ctx, "job", time.Second); err != nil {
+		t.Fatalf("TryAcquire after expiry: %v", err)
+	}
+	if err := ls.Renew(ctx, lock, time.Second); !errors.Is(err, ErrLockLost) {
+		t.Errorf("got %v, want ErrLockLost", err)
+	}
+}
+
+func TestLockHoldCancelsWhenLost(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ls := NewLockService(newTestCache(t, mr.Addr(), "locks", 0), nil, "instance-a", testLogger)
+
+	lock, err := ls.TryAcquire(context.Background(), "job", 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("TryAcquire: %v", err)
+	}
+	ctx, stop := ls.Hold(context.Background(), lock, 300*time.Millisecond)
+	defer stop()
+
+	// Renewals keep the lease from running out
+	mr.FastForward(250 * time.Millisecond)
+	time.Sleep(250 * time.Millisecond)
+	if !mr.Exists("test:lock:job") || ctx.Err() != nil {
+		t.Fatal("expected the held lock to be renewed")
+	}
+
+	mr.Del("test:lock:job")
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected losing the lock to cancel its work")
+	}
+}
+
+func TestLockPostgresIsAuthoritative(t *testing.T) {
+	// With a database configured, locks are leases even while Redis fails,
+	// so replicas never hold the same lock on different backends
+	db, mock := newTestDB(t)
+	mr := miniredis.RunT(t)
+	ls := NewLockService(newTestCache(t, mr.Addr(), "locks", 0), db, "instance-a", testLogger)
+	mr.Close()
+
+	mock.ExpectExec(`INSERT INTO distributed_locks`).
+		WithArgs("job", "instance-a", sqlmock.AnyArg(), int64(1000)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO distributed_locks`).
+		WithArgs("job", "instance-a", sqlmock.AnyArg(), int64(1000)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE distributed_locks SET expires_at`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	lock, err := ls.TryAcquire(context.Background(), "job", time.Second)
+	if err != nil {
+		t.Fatalf("TryAcquire: %v", err)
+	}
+	if lock.Backend != lockBackendPostgres {
+		t.Errorf("got backend %s, want postgres", lock.Backend)
+	}
+	if _, err := ls.TryAcquire(context.Background(), "job", time.Second); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("got %v, want ErrLockHeld", err)
+	}
+	if err := ls.Renew(context.Background(), lock, time.Second); !errors.Is(err, ErrLockLost) {
+		t.Errorf("got %v, want ErrLockLost", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
\ No newline at end of file
@@ -2,21 +2,41 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 	"marketplace-app/internal/config"
+	"marketplace-app/internal/metrics"
 	"marketplace-app/internal/models"
 )
 
+// Token refreshes for a company are serialized across instances, since
+// refresh tokens rotate and a second refresh with a consumed token fails
+const (
+	tokenRefreshLockTTL  = 2 * time.Minute
+	tokenRefreshLockWait = 45 * time.Second
+)
+
+// ErrReauthRequired is returned when a company's token is rejected upstream
+// and cannot be refreshed, so the company must go through OAuth again
+var ErrReauthRequired = errors.New("company must re-authorize")
+
 type NangoService struct {
-	db     *gorm.DB
-	config *config.Config
-	client *http.Client
+	db        *gorm.DB
+	config    *config.Config
+	upstream  *UpstreamClient
+	policies  *TokenPolicies
+	locks     *LockService
+	refreshes singleflight.Group
+	logger    *slog.Logger
 }
 
 type NangoAuthResponse struct {
@@ -42,6 +62,20 @@ type NangoLocationResponse struct {
 	Website       string `json:"website"`
 }
 
+// NangoLocationUpdateRequest carries the editable details of a location
+type NangoLocationUpdateRequest struct {
+	BusinessName string `json:"business_name"`
+	BusinessType string `json:"business_type"`
+	Address      string `json:"address"`
+	City         string `json:"city"`
+	State        string `json:"state"`
+	ZipCode      string `json:"zip_code"`
+	Country      string `json:"country"`
+	Phone        string `json:"phone"`
+	Email        string `json:"email"`
+	Website      string `json:"website"`
+}
+
 type NangoContactResponse struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
@@ -72,11 +106,14 @@ type NangoTokenRefreshResponse struct {
 	ExpiresAt    time.Time `json:"expires_at"`
 }
 
-func NewNangoService(db *gorm.DB, cfg *config.Config) *NangoService {
+func NewNangoService(db *gorm.DB, cfg *config.Config, upstream *UpstreamClient, policies *TokenPolicies, locks *LockService, logger *slog.Logger) *NangoService {
 	return &NangoService{
-		db:     db,
-		config: cfg,
-		client: &http.Client{Timeout: 30 * time.Second},
+		db:       db,
+		config:   cfg,
+		upstream: upstream,
+		policies: policies,
+		locks:    locks,
+		logger:   logger,
 	}
 }
 
@@ -86,38 +123,41 @@ func (n *NangoService) GetPublicKey() string {
 }
 
 // ProcessOAuthCallback handles the OAuth callback from Nango
-func (ns *NangoService) ProcessOAuthCallback(authCode string) (*models.Company, error) {
+func (ns *NangoService) ProcessOAuthCallback(ctx context.Context, authCode string) (*models.Company, error) {
 	// Exchange auth code for tokens
-	authResp, err := ns.exchangeAuthCode(authCode)
+	authResp, err := ns.exchangeAuthCode(ctx, authCode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange auth code: %w", err)
 	}
 
 	// Create or update company record
+	issuedAt := time.Now()
 	company := &models.Company{
-		CompanyID:    authResp.CompanyID,
-		CompanyName:  authResp.CompanyName,
-		AccessToken:  authResp.AccessToken,
-		RefreshToken: authResp.RefreshToken,
-		TokenExpiry:  authResp.ExpiresAt,
-		IsActive:     true,
+		CompanyID:     authResp.CompanyID,
+		CompanyName:   authResp.CompanyName,
+		AccessToken:   authResp.AccessToken,
+		RefreshToken:  authResp.RefreshToken,
+		TokenExpiry:   authResp.ExpiresAt,
+		TokenIssuedAt: issuedAt,
+		Provider:      ns.config.NangoProvider,
+		IsActive:      true,
 	}
 
 	// Upsert company
-	result := ns.db.Where("company_id = ?", company.CompanyID).FirstOrCreate(company)
+	result := ns.db.WithContext(ctx).Where("company_id = ?", company.CompanyID).FirstOrCreate(company)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to create/update company: %w", result.Error)
 	}
 
-	// Create token refresh record
+	// Create token refresh record, scheduling the refresh per the provider's policy
 	tokenRefresh := &models.TokenRefresh{
 		CompanyID:   company.ID,
-		LastRefresh: time.Now(),
-		NextRefresh: authResp.ExpiresAt.Add(-24 * time.Hour), // Refresh 24 hours before expiry
+		LastRefresh: issuedAt,
+		NextRefresh: ns.policies.ForCompany(company).NextRefresh(issuedAt, authResp.ExpiresAt),
 		Status:      "active",
 	}
 
-	if err := ns.db.Create(tokenRefresh).Error; err != nil {
+	if err := ns.db.WithContext(ctx).Create(tokenRefresh).Error; err != nil {
 		return nil, fmt.Errorf("failed to create token refresh record: %w", err)
 	}
 
@@ -125,14 +165,14 @@ func (ns *NangoService) ProcessOAuthCallback(authCode string) (*models.Company,
 }
 
 // GetLocations fetches all locations for a company
-func (ns *NangoService) GetLocations(companyID string) ([]models.Location, error) {
+func (ns *NangoService) GetLocations(ctx context.Context, companyID string) ([]models.Location, error) {
 	company := &models.Company{}
-	if err := ns.db.Where("company_id = ?", companyID).First(company).Error; err != nil {
+	if err := ns.db.WithContext(ctx).Where("company_id = ?", companyID).First(company).Error; err != nil {
 		return nil, fmt.Errorf("company not found: %w", err)
 	}
 
 	// Fetch locations from Nango API
-	locationsResp, err := ns.fetchLocationsFromAPI(company.AccessToken, companyID)
+	locationsResp, err := ns.fetchLocationsFromAPI(ctx, company)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch locations: %w", err)
 	}
@@ -157,52 +197,143 @@ func (ns *NangoService) GetLocations(companyID string) ([]models.Location, error
 		}
 
 		// Upsert location
-		ns.db.Where("location_id = ?", location.LocationID).FirstOrCreate(&location)
+		ns.db.WithContext(ctx).Where("location_id = ?", location.LocationID).FirstOrCreate(&location)
 		locations = append(locations, location)
 	}
 
 	return locations, nil
 }
 
-// RefreshToken refreshes the access token for a company
-func (ns *NangoService) RefreshToken(companyID string) error {
+// UpdateLocation sends a location's details to the CRM
+func (ns *NangoService) UpdateLocation(ctx context.Context, company *models.Company, location *models.Location) error {
+	url := fmt.Sprintf("%s/api/v2/companies/%s/locations/%s", ns.config.NangoServerURL, company.CompanyID, location.LocationID)
+	payload := NangoLocationUpdateRequest{
+		BusinessName: location.BusinessName,
+		BusinessType: location.BusinessType,
+		Address:      location.Address,
+		City:         location.City,
+		State:        location.State,
+		ZipCode:      location.ZipCode,
+		Country:      location.Country,
+		Phone:        location.Phone,
+		Email:        location.Email,
+		Website:      location.Website,
+	}
+
+	var result NangoLocationResponse
+	return ns.makeAuthenticatedRequest(ctx, company, "PUT", "company_location_update", url, payload, &result)
+}
+
+// RefreshToken refreshes the access token for a company and returns the
+// updated company. Concurrent calls for the same company, in this process or
+// on other instances, are serialized; callers that wait on an in-flight
+// refresh receive its result instead of refreshing again. A caller whose
+// context ends stops waiting, but the refresh itself runs to completion.
+func (ns *NangoService) RefreshToken(ctx context.Context, companyID string) (*models.Company, error) {
+	results := ns.refreshes.DoChan(companyID, func() (interface{}, error) {
+		// Once the provider has rotated the refresh token the new one must be
+		// saved, so the refresh is detached from the caller's cancellation
+		refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tokenRefreshLockTTL)
+		defer cancel()
+		return ns.refreshTokenExclusive(refreshCtx, companyID)
+	})
+
+	var result singleflight.Result
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result = <-results:
+	}
+
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	if result.Shared {
+		ns.logger.DebugContext(ctx, "Shared in-flight token refresh", "company_id", companyID)
+	}
+
+	// Hand each caller its own copy of the refreshed company
+	company := *result.Val.(*models.Company)
+	return &company, nil
+}
+
+// Private helper methods
+
+func (ns *NangoService) refreshTokenExclusive(ctx context.Context, companyID string) (*models.Company, error) {
+	// Note the tokens we start from: if they have changed once the lock is
+	// held, another instance refreshed them meanwhile. Comparing tokens
+	// rather than timestamps is immune to clock skew between instances.
+	initial := &models.Company{}
+	if err := ns.db.WithContext(ctx).Select("access_token", "refresh_token").Where("company_id = ?", companyID).First(initial).Error; err != nil {
+		recordTokenRefresh(nil, metrics.RefreshFailed)
+		return nil, fmt.Errorf("company not found: %w", err)
+	}
+
+	lock, err := ns.locks.Acquire(ctx, tokenRefreshLockName(companyID), tokenRefreshLockTTL, tokenRefreshLockWait)
+	if err != nil {
+		recordTokenRefresh(nil, metrics.RefreshFailed)
+		return nil, fmt.Errorf("failed to acquire token refresh lock for company %s: %w", companyID, err)
+	}
+	defer func() {
+		if err := ns.locks.Release(ctx, lock); err != nil {
+			ns.logger.WarnContext(ctx, "Failed to release token refresh lock", "company_id", companyID, "error", err)
+		}
+	}()
+
+	// Load the company only once the lock is held so the latest refresh token is used
 	company := &models.Company{}
-	if err := ns.db.Where("company_id = ?", companyID).First(company).Error; err != nil {
-		return fmt.Errorf("company not found: %w", err)
+	if err := ns.db.WithContext(ctx).Where("company_id = ?", companyID).First(company).Error; err != nil {
+		recordTokenRefresh(nil, metrics.RefreshFailed)
+		return nil, fmt.Errorf("company not found: %w", err)
+	}
+
+	// Another instance refreshed the token while we waited for the lock
+	if company.AccessToken != initial.AccessToken || company.RefreshToken != initial.RefreshToken {
+		ns.logger.InfoContext(ctx, "Token was refreshed by another instance", "company_id", companyID)
+		recordTokenRefresh(company, metrics.RefreshSkipped)
+		return company, nil
 	}
 
 	// Refresh token via Nango API
-	refreshResp, err := ns.refreshTokenAPI(company.RefreshToken, companyID)
+	refreshResp, err := ns.refreshTokenAPI(ctx, company.RefreshToken, companyID)
 	if err != nil {
-		return fmt.Errorf("failed to refresh token: %w", err)
+		switch upstreamStatus(err) {
+		case http.StatusBadRequest, http.StatusUnauthorized:
+			recordTokenRefresh(company, metrics.RefreshReauthRequired)
+		default:
+			recordTokenRefresh(company, metrics.RefreshFailed)
+		}
+		return nil, fmt.Errorf("failed to refresh token: %w", err)
 	}
 
 	// Update company with new tokens
+	issuedAt := time.Now()
 	company.AccessToken = refreshResp.AccessToken
 	company.RefreshToken = refreshResp.RefreshToken
 	company.TokenExpiry = refreshResp.ExpiresAt
+	company.TokenIssuedAt = issuedAt
 
-	if err := ns.db.Save(company).Error; err != nil {
-		return fmt.Errorf("failed to update company tokens: %w", err)
+	if err := ns.db.WithContext(ctx).Save(company).Error; err != nil {
+		recordTokenRefresh(company, metrics.RefreshFailed)
+		return nil, fmt.Errorf("failed to update company tokens: %w", err)
 	}
+	recordTokenRefresh(company, metrics.RefreshSucceeded)
 
 	// Update token refresh record
 	tokenRefresh := &models.TokenRefresh{}
-	if err := ns.db.Where("company_id = ?", company.ID).First(tokenRefresh).Error; err == nil {
-		tokenRefresh.LastRefresh = time.Now()
-		tokenRefresh.NextRefresh = refreshResp.ExpiresAt.Add(-24 * time.Hour)
+	if err := ns.db.WithContext(ctx).Where("company_id = ?", company.ID).First(tokenRefresh).Error; err == nil {
+		tokenRefresh.LastRefresh = issuedAt
+		tokenRefresh.NextRefresh = ns.policies.ForCompany(company).NextRefresh(issuedAt, refreshResp.ExpiresAt)
 		tokenRefresh.RefreshCount++
 		tokenRefresh.Status = "active"
 		tokenRefresh.ErrorMessage = ""
-		ns.db.Save(tokenRefresh)
+		ns.db.WithContext(ctx).Save(tokenRefresh)
 	}
 
-	return nil
+	return company, nil
 }
 
-// Private helper methods
-
-func (ns *NangoService) exchangeAuthCode(authCode string) (*NangoAuthResponse, error) {
+func (ns *NangoService) exchangeAuthCode(ctx context.Context, authCode string) (*NangoAuthResponse, error) {
 	url := fmt.Sprintf("%s/oauth/token", ns.config.NangoServerURL)
 	payload := map[string]string{
 		"code":          authCode,
@@ -212,24 +343,24 @@ func (ns *NangoService) exchangeAuthCode(authCode string) (*NangoAuthResponse, e
 	}
 
 	var result NangoAuthResponse
-	err := ns.makeNangoRequest("POST", url, payload, "", &result)
+	err := ns.makeNangoRequest(ctx, "POST", "oauth_token", url, payload, "", "", &result)
 	if err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
-func (ns *NangoService) fetchLocationsFromAPI(accessToken, companyID string) ([]NangoLocationResponse, error) {
-	url := fmt.Sprintf("%s/api/v2/companies/%s/locations", ns.config.NangoServerURL, companyID)
+func (ns *NangoService) fetchLocationsFromAPI(ctx context.Context, company *models.Company) ([]NangoLocationResponse, error) {
+	url := fmt.Sprintf("%s/api/v2/companies/%s/locations", ns.config.NangoServerURL, company.CompanyID)
 	var result []NangoLocationResponse
-	err := ns.makeNangoRequest("GET", url, nil, accessToken, &result)
+	err := ns.makeAuthenticatedRequest(ctx, company, "GET", "company_locations", url, nil, &result)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func (ns *NangoService) refreshTokenAPI(refreshToken, companyID string) (*NangoTokenRefreshResponse, error) {
+func (ns *NangoService) refreshTokenAPI(ctx context.Context, refreshToken, companyID string) (*NangoTokenRefreshResponse, error) {
 	url := fmt.Sprintf("%s/oauth/refresh", ns.config.NangoServerURL)
 	payload := NangoTokenRefreshRequest{
 		RefreshToken: refreshToken,
@@ -237,14 +368,45 @@ func (ns *NangoService) refreshTokenAPI(refreshToken, companyID string) (*NangoT
 	}
 
 	var result NangoTokenRefreshResponse
-	err := ns.makeNangoRequest("POST", url, payload, "", &result)
+	err := ns.makeNangoRequest(ctx, "POST", "oauth_refresh", url, payload, "", "", &result)
 	if err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
-func (ns *NangoService) makeNangoRequest(method, url string, payload interface{}, accessToken string, result interface{}) error {
+// makeAuthenticatedRequest calls the API with the company's access token. If
+// the token is rejected it is refreshed once and the request retried; a
+// second rejection, or a refresh the provider refuses, yields ErrReauthRequired.
+// On refresh the company is updated in place with the new tokens.
+func (ns *NangoService) makeAuthenticatedRequest(ctx context.Context, company *models.Company, method, endpoint, url string, payload interface{}, result interface{}) error {
+	err := ns.makeNangoRequest(ctx, method, endpoint, url, payload, company.AccessToken, company.CompanyID, result)
+	if upstreamStatus(err) != http.StatusUnauthorized {
+		return err
+	}
+
+	ns.logger.InfoContext(ctx, "Access token rejected, refreshing and retrying", "company_id", company.CompanyID)
+	refreshed, refreshErr := ns.RefreshToken(ctx, company.CompanyID)
+	if refreshErr != nil {
+		switch upstreamStatus(refreshErr) {
+		case http.StatusBadRequest, http.StatusUnauthorized:
+			return fmt.Errorf("%w: company %s: %w", ErrReauthRequired, company.CompanyID, refreshErr)
+		}
+		return fmt.Errorf("failed to refresh rejected token: %w", refreshErr)
+	}
+	*company = *refreshed
+
+	err = ns.makeNangoRequest(ctx, method, endpoint, url, payload, company.AccessToken, company.CompanyID, result)
+	if upstreamStatus(err) == http.StatusUnauthorized {
+		return fmt.Errorf("%w: company %s: refreshed token was rejected: %w", ErrReauthRequired, company.CompanyID, err)
+	}
+	return err
+}
+
+// makeNangoRequest calls the Nango API. Requests acting on a company's data
+// pass its ID as the resource so they are paced per GoHighLevel's rate limits.
+// The endpoint names the API operation in metrics.
+func (ns *NangoService) makeNangoRequest(ctx context.Context, method, endpoint, url string, payload interface{}, accessToken, resource string, result interface{}) error {
 	var body io.Reader
 	if payload != nil {
 		jsonData, err := json.Marshal(payload)
@@ -254,7 +416,7 @@ func (ns *NangoService) makeNangoRequest(method, url string, payload interface{}
 		body = bytes.NewBuffer(jsonData)
 	}
 
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -264,14 +426,15 @@ func (ns *NangoService) makeNangoRequest(method, url string, payload interface{}
 		req.Header.Set("Authorization", "Bearer "+accessToken)
 	}
 
-	resp, err := ns.client.Do(req)
+	resp, err := ns.upstream.Do(req, UpstreamTarget{Provider: ProviderNango, Endpoint: endpoint, Resource: resource})
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("API request failed with status %d", resp.StatusCode)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamErrorBody))
+		return ParseUpstreamError(ProviderNango, resp, body)
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
@@ -279,4 +442,17 @@ func (ns *NangoService) makeNangoRequest(method, url string, payload interface{}
 	}
 
 	return nil
+}
+
+// recordTokenRefresh counts a refresh outcome under the company's provider
+func recordTokenRefresh(company *models.Company, outcome string) {
+	provider := "unknown"
+	if company != nil && company.Provider != "" {
+		provider = company.Provider
+	}
+	metrics.TokenRefreshesTotal.WithLabelValues(provider, outcome).Inc()
+}
+
+func tokenRefreshLockName(companyID string) string {
+	return fmt.Sprintf("token_refresh:%s", companyID)
 }
\ No newline at end of file
@@ -0,0 +1,465 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"marketplace-app/internal/config"
+)
+
+// slidingWindowScript admits a request if each window KEYS[i] holds fewer
+// than ARGV[2i] requests from the last ARGV[2i-1] microseconds, and then
+// records it, under the unique member in the last ARGV, in all of them. A
+// window is a sorted set of request times by Redis's clock, trimmed, counted
+// and added to in one step so concurrent requests on any replica never
+// overshoot a limit. It returns whether the request was admitted, which
+// window is reported (the first to refuse it, else the first), the requests
+// in that window and the microseconds until the oldest of them leaves it.
+var slidingWindowScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local counts = {}
+local refused = 0
+for i, key in ipairs(KEYS) do
+	redis.call("ZREMRANGEBYSCORE", key, "-inf", now - tonumber(ARGV[2 * i - 1]))
+	counts[i] = redis.call("ZCARD", key)
+	if refused == 0 and counts[i] >= tonumber(ARGV[2 * i]) then
+		refused = i
+	end
+end
+
+for i, key in ipairs(KEYS) do
+	local window = tonumber(ARGV[2 * i - 1])
+	if refused == 0 then
+		redis.call("ZADD", key, now, ARGV[#ARGV])
+		counts[i] = counts[i] + 1
+	end
+	redis.call("PEXPIRE", key, math.ceil(window / 1000))
+end
+
+local reported = refused
+if reported == 0 then
+	reported = 1
+end
+local reset = 0
+local oldest = redis.call("ZRANGE", KEYS[reported], 0, 0, "WITHSCORES")
+if oldest[2] then
+	reset = tonumber(oldest[2]) + tonumber(ARGV[2 * reported - 1]) - now
+end
+
+local allowed = 0
+if refused == 0 then
+	allowed = 1
+end
+return {allowed, reported, counts[reported], reset}
+`)
+
+// consumeQuotaScript counts a request against the daily counter KEYS[1]
+// unless it has reached the quota ARGV[1] (0 for none), keeping the counter
+// for ARGV[2] milliseconds. It returns whether the request was counted and
+// the requests counted so far.
+var consumeQuotaScript = redis.NewScript(`
+local used = tonumber(redis.call("GET", KEYS[1]) or "0")
+local quota = tonumber(ARGV[1])
+if quota > 0 and used >= quota then
+	return {0, used}
+end
+used = redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[2])
+return {1, used}
+`)
+
+// refundQuotaScript takes a request back off the daily counter KEYS[1]
+var refundQuotaScript = redis.NewScript(`
+if tonumber(redis.call("GET", KEYS[1]) or "0") > 0 then
+	return redis.call("DECR", KEYS[1])
+end
+return 0
+`)
+
+// quotaRetentionDays is how many days of daily request counts are kept
+const quotaRetentionDays = 7
+
+// RateWindow limits the requests recorded under Key within a sliding window
+type RateWindow struct {
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+// RateLimitResult is the outcome of a rate limit check
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the oldest request in the window leaves it
+	// and frees a slot
+	Reset time.Duration
+}
+
+// QuotaResult is the outcome of counting a request against a daily quota
+type QuotaResult struct {
+	Allowed bool
+	// Limit is the daily quota, 0 when unlimited
+	Limit int64
+	Used  int64
+	// Reset is how long until the quota renews at midnight UTC
+	Reset time.Duration
+
+	// counter is the daily counter the request was counted in, and memory
+	// whether that counter is kept in memory rather than Redis
+	counter string
+	memory  bool
+}
+
+// Remaining returns the requests left today, or -1 when unlimited
+func (q QuotaResult) Remaining() int64 {
+	if q.Limit <= 0 {
+		return -1
+	}
+	if q.Used >= q.Limit {
+		return 0
+	}
+	return q.Limit - q.Used
+}
+
+// DailyUsage is the number of requests counted on a UTC day
+type DailyUsage struct {
+	Date     string `json:"date"`
+	Requests int64  `json:"requests"`
+}
+
+// RateLimiter enforces sliding-window request limits. Windows are kept in
+// Redis so every replica shares them; while Redis is unavailable each
+// replica keeps exact windows of its own in memory.
+type RateLimiter struct {
+	redisClient *redis.Client
+	keyPrefix   string
+	limit       int
+	window      time.Duration
+	enabled     bool
+	logger      *slog.Logger
+
+	mu        sync.Mutex
+	windows   map[string][]time.Time
+	quotas    map[string]int64
+	lastSweep time.Time
+}
+
+// NewRateLimiter admits RateLimitRPS requests per second on average over a
+// sliding RateLimitWindow
+func NewRateLimiter(cfg *config.Config, cache *CacheService, logger *slog.Logger) *RateLimiter {
+	window := cfg.RateLimitWindow
+	if window <= 0 {
+		window = time.Minute
+	}
+
+	rl := &RateLimiter{
+		keyPrefix: cfg.CacheKeyPrefix,
+		window:    window,
+		enabled:   cfg.RateLimitEnabled,
+		logger:    logger,
+		windows:   make(map[string][]time.Time),
+		quotas:    make(map[string]int64),
+	}
+	rl.limit = rl.WindowLimit(float64(cfg.RateLimitRPS))
+	if cache != nil {
+		rl.redisClient = cache.redisClient
+	}
+	return rl
+}
+
+// WindowLimit returns how many requests the window admits at an average of
+// rps requests per second
+func (rl *RateLimiter) WindowLimit(rps float64) int {
+	limit := int(math.Ceil(rps * rl.window.Seconds()))
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+// Enabled reports whether requests should be rate limited
+func (rl *RateLimiter) Enabled() bool {
+	return rl.enabled
+}
+
+// Limit returns the configured number of requests admitted per window
+func (rl *RateLimiter) Limit() int {
+	return rl.limit
+}
+
+// Window returns the length of the sliding window
+func (rl *RateLimiter) Window() time.Duration {
+	return rl.window
+}
+
+// DefaultLimits returns the configured limits, which apply to tenants
+// without a plan
+func (rl *RateLimiter) DefaultLimits() *TenantLimits {
+	return &TenantLimits{Plan: DefaultPlanName, Limit: rl.limit}
+}
+
+// TenantWindows returns the windows enforcing limits for a company: its
+// sliding window and, with a burst limit, a one second window
+func (rl *RateLimiter) TenantWindows(companyID string, limits *TenantLimits) []RateWindow {
+	key := TenantRateLimitKey(companyID)
+	windows := []RateWindow{{Key: key, Limit: limits.Limit, Window: rl.window}}
+	if limits.Burst > 0 {
+		windows = append(windows, RateWindow{Key: key + ":burst", Limit: limits.Burst, Window: time.Second})
+	}
+	return windows
+}
+
+// ConsumeTenantQuota counts a request against a company's daily quota
+func (rl *RateLimiter) ConsumeTenantQuota(ctx context.Context, companyID string, limits *TenantLimits) QuotaResult {
+	return rl.ConsumeQuota(ctx, TenantRateLimitKey(companyID), limits.DailyQuota)
+}
+
+// RefundQuota takes back a request ConsumeQuota admitted, for one refused
+// afterwards, and returns the quota without it
+func (rl *RateLimiter) RefundQuota(ctx context.Context, result QuotaResult) QuotaResult {
+	if !result.Allowed {
+		return result
+	}
+	result.Allowed = false
+	if result.Used > 0 {
+		result.Used--
+	}
+
+	if !result.memory {
+		err := refundQuotaScript.Run(ctx, rl.redisClient, []string{rl.keyPrefix + result.counter}).Err()
+		if err != nil {
+			rl.logger.WarnContext(ctx, "Failed to refund quota in Redis", "error", err)
+		}
+		return result
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.quotas[result.counter] > 0 {
+		rl.quotas[result.counter]--
+	}
+	return result
+}
+
+// TenantRateLimitKey is the key a company's requests are counted under
+func TenantRateLimitKey(companyID string) string {
+	return "tenant:" + companyID
+}
+
+// Allow records a request against key and reports whether it is within limit
+// requests per window. Rejected requests do not count towards the window.
+func (rl *RateLimiter) Allow(ctx context.Context, key string, limit int) RateLimitResult {
+	return rl.AllowWindows(ctx, RateWindow{Key: key, Limit: limit, Window: rl.window})
+}
+
+// AllowWindows records a request in every window if each of them admits it.
+// The result describes the first window that refused the request, or the
+// first window when it was admitted.
+func (rl *RateLimiter) AllowWindows(ctx context.Context, windows ...RateWindow) RateLimitResult {
+	if rl.redisClient != nil {
+		result, err := rl.allowRedis(ctx, windows)
+		if err == nil {
+			return result
+		}
+		rl.logger.WarnContext(ctx, "Rate limit check failed in Redis, using in-memory window", "error", err)
+	}
+	return rl.allowMemory(windows, time.Now())
+}
+
+func (rl *RateLimiter) allowRedis(ctx context.Context, windows []RateWindow) (RateLimitResult, error) {
+	keys := make([]string, len(windows))
+	args := make([]interface{}, 0, 2*len(windows)+1)
+	for i, w := range windows {
+		keys[i] = rl.keyPrefix + rateLimitKey(w.Key)
+		args = append(args, w.Window.Microseconds(), w.Limit)
+	}
+	args = append(args, uuid.NewString())
+
+	values, err := slidingWindowScript.Run(ctx, rl.redisClient, keys, args...).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	reported := windows[values[1]-1]
+	return RateLimitResult{
+		Allowed:   values[0] == 1,
+		Limit:     reported.Limit,
+		Remaining: reported.Limit - int(values[2]),
+		Reset:     time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
+
+func (rl *RateLimiter) allowMemory(windows []RateWindow, now time.Time) RateLimitResult {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	reported := 0
+	allowed := true
+	for i, w := range windows {
+		times := trimWindow(rl.windows[w.Key], now.Add(-w.Window))
+		rl.windows[w.Key] = times
+		if allowed && len(times) >= w.Limit {
+			reported, allowed = i, false
+		}
+	}
+	if allowed {
+		for _, w := range windows {
+			rl.windows[w.Key] = append(rl.windows[w.Key], now)
+		}
+	}
+
+	rl.sweep(now)
+
+	w := windows[reported]
+	times := rl.windows[w.Key]
+	var reset time.Duration
+	if len(times) > 0 {
+		reset = times[0].Add(w.Window).Sub(now)
+	}
+	return RateLimitResult{
+		Allowed:   allowed,
+		Limit:     w.Limit,
+		Remaining: w.Limit - len(times),
+		Reset:     reset,
+	}
+}
+
+// sweep drops the windows of clients that have gone quiet, and daily
+// counters past retention, once per window. rl.mu must be held.
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) <= rl.window {
+		return
+	}
+
+	cutoff := now.Add(-rl.window)
+	for key, times := range rl.windows {
+		// Windows are never longer than the configured one
+		if len(trimWindow(times, cutoff)) == 0 {
+			delete(rl.windows, key)
+		}
+	}
+
+	oldest := quotaDay(now.AddDate(0, 0, -quotaRetentionDays))
+	for key := range rl.quotas {
+		if key[len(key)-len(oldest):] < oldest {
+			delete(rl.quotas, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// WindowCount returns how many requests key has in the configured window
+func (rl *RateLimiter) WindowCount(ctx context.Context, key string) (int, error) {
+	now := time.Now()
+	if rl.redisClient != nil {
+		min := strconv.FormatInt(now.Add(-rl.window).UnixMicro(), 10)
+		count, err := rl.redisClient.ZCount(ctx, rl.keyPrefix+rateLimitKey(key), "("+min, "+inf").Result()
+		return int(count), err
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return len(trimWindow(rl.windows[key], now.Add(-rl.window))), nil
+}
+
+// ConsumeQuota counts a request against key's requests today and reports
+// whether it is within quota, 0 meaning unlimited. Refused requests are not
+// counted. Counts are kept for quotaRetentionDays whatever the quota.
+func (rl *RateLimiter) ConsumeQuota(ctx context.Context, key string, quota int64) QuotaResult {
+	now := time.Now().UTC()
+	dayKey := quotaKey(key, now)
+	result := QuotaResult{Limit: quota, Reset: now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now), counter: dayKey}
+
+	if rl.redisClient != nil {
+		retention := time.Duration(quotaRetentionDays+1) * 24 * time.Hour
+		values, err := consumeQuotaScript.Run(ctx, rl.redisClient, []string{rl.keyPrefix + dayKey}, quota, retention.Milliseconds()).Int64Slice()
+		if err == nil {
+			result.Allowed, result.Used = values[0] == 1, values[1]
+			return result
+		}
+		rl.logger.WarnContext(ctx, "Quota check failed in Redis, using in-memory counter", "error", err)
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	result.memory = true
+	result.Used = rl.quotas[dayKey]
+	if quota <= 0 || result.Used < quota {
+		result.Used++
+		rl.quotas[dayKey] = result.Used
+		result.Allowed = true
+	}
+	rl.sweep(now)
+	return result
+}
+
+// DailyUsage returns key's request counts for each of the last days, today
+// first
+func (rl *RateLimiter) DailyUsage(ctx context.Context, key string, days int) ([]DailyUsage, error) {
+	now := time.Now().UTC()
+	usage := make([]DailyUsage, days)
+	keys := make([]string, days)
+	for i := range usage {
+		day := now.AddDate(0, 0, -i)
+		usage[i].Date = quotaDay(day)
+		keys[i] = quotaKey(key, day)
+	}
+
+	if rl.redisClient != nil {
+		prefixed := make([]string, days)
+		for i, k := range keys {
+			prefixed[i] = rl.keyPrefix + k
+		}
+		values, err := rl.redisClient.MGet(ctx, prefixed...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			if s, ok := value.(string); ok {
+				usage[i].Requests, _ = strconv.ParseInt(s, 10, 64)
+			}
+		}
+		return usage, nil
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for i, k := range keys {
+		usage[i].Requests = rl.quotas[k]
+	}
+	return usage, nil
+}
+
+// trimWindow drops the request times at or before cutoff
+func trimWindow(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+func rateLimitKey(key string) string {
+	return "rate_limit:" + key
+}
+
+// quotaKey is the daily request counter of key on day. Quotas live outside
+// the rate_limit prefix so flushing rate limits does not reset them.
+func quotaKey(key string, day time.Time) string {
+	return "quota:" + key + ":" + quotaDay(day)
+}
+
+func quotaDay(day time.Time) string {
+	return day.UTC().Format("2006-01-02")
+}
\ No newline at end of file
@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"marketplace-app/internal/models"
+)
+
+var (
+	// ErrPlanNotFound is returned when no rate limit plan has the given name
+	ErrPlanNotFound = errors.New("rate limit plan not found")
+	// ErrPlanExists is returned when creating a plan whose name is taken
+	ErrPlanExists = errors.New("rate limit plan already exists")
+	// ErrInvalidPlan is returned when a plan fails validation
+	ErrInvalidPlan = errors.New("invalid rate limit plan")
+	// ErrCompanyNotFound is returned when assigning a plan to, or reading the
+	// usage of, an unknown company
+	ErrCompanyNotFound = errors.New("company not found")
+)
+
+// DefaultPlanName names the plan applied to companies without one. Without
+// a plan of that name the configured rate limit applies.
+const DefaultPlanName = "default"
+
+// rateLimitPlansTag tags every cached tenant limit, so changing a plan drops
+// the limits of all companies on it
+const rateLimitPlansTag = "rate_limit_plans"
+
+// tenantLimitsTTL is how long a tenant's limits are cached
+const tenantLimitsTTL = 5 * time.Minute
+
+// TenantLimits are the limits enforced for a company, resolved from its plan
+type TenantLimits struct {
+	Plan string `json:"plan"`
+	// Limit is the requests admitted per rate limit window
+	Limit      int   `json:"limit"`
+	Burst      int   `json:"burst"`
+	DailyQuota int64 `json:"daily_quota"`
+}
+
+// TenantUsage is a company's current rate limit and quota consumption
+type TenantUsage struct {
+	CompanyID      string        `json:"company_id"`
+	Limits         *TenantLimits `json:"limits"`
+	WindowSeconds  float64       `json:"window_seconds"`
+	WindowRequests int           `json:"window_requests"`
+	// Daily lists requests per UTC day, today first
+	Daily []DailyUsage `json:"daily"`
+}
+
+// RateLimitPlanUpdate holds the mutable fields of a plan
+type RateLimitPlanUpdate struct {
+	Description       *string  `json:"description"`
+	RequestsPerSecond *float64 `json:"requests_per_second"`
+	Burst             *int     `json:"burst"`
+	DailyQuota        *int64   `json:"daily_quota"`
+}
+
+// RateLimitPlanService stores rate limit plans and resolves the limits that
+// apply to each company
+type RateLimitPlanService struct {
+	db      *gorm.DB
+	cache   *CacheService
+	limiter *RateLimiter
+	logger  *slog.Logger
+}
+
+func NewRateLimitPlanService(db *gorm.DB, cache *CacheService, limiter *RateLimiter, logger *slog.Logger) *RateLimitPlanService {
+	return &RateLimitPlanService{
+		db:      db,
+		cache:   cache,
+		limiter: limiter,
+		logger:  logger,
+	}
+}
+
+// ListPlans returns all plans ordered by name
+func (ps *RateLimitPlanService) ListPlans(ctx context.Context) ([]models.RateLimitPlan, error) {
+	var plans []models.RateLimitPlan
+	if err := ps.db.WithContext(ctx).Order("name").Find(&plans).Error; err != nil {
+		return nil, fmt.Errorf("failed to list rate limit plans: %w", err)
+	}
+	return plans, nil
+}
+
+// CreatePlan stores a new plan
+func (ps *RateLimitPlanService) CreatePlan(ctx context.Context, plan *models.RateLimitPlan) error {
+	if err := validatePlan(plan); err != nil {
+		return err
+	}
+
+	// The unique index on name refuses a taken name, even one created concurrently
+	err := ps.db.WithContext(ctx).Create(plan).Error
+	if isUniqueViolation(err) {
+		return ErrPlanExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create rate limit plan: %w", err)
+	}
+
+	// A new default plan replaces the configured limit
+	if plan.Name == DefaultPlanName {
+		ps.invalidateLimits(ctx)
+	}
+	return nil
+}
+
+// UpdatePlan changes a plan's limits, which apply to its companies within
+// moments on every replica
+func (ps *RateLimitPlanService) UpdatePlan(ctx context.Context, name string, update RateLimitPlanUpdate) (*models.RateLimitPlan, error) {
+	plan, err := ps.findPlan(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Description != nil {
+		plan.Description = *update.Description
+	}
+	if update.RequestsPerSecond != nil {
+		plan.RequestsPerSecond = *update.RequestsPerSecond
+	}
+	if update.Burst != nil {
+		plan.Burst = *update.Burst
+	}
+	if update.DailyQuota != nil {
+		plan.DailyQuota = *update.DailyQuota
+	}
+
+	if err := validatePlan(plan); err != nil {
+		return nil, err
+	}
+
+	if err := ps.db.WithContext(ctx).Save(plan).Error; err != nil {
+		return nil, fmt.Errorf("failed to update rate limit plan: %w", err)
+	}
+
+	ps.invalidateLimits(ctx)
+	return plan, nil
+}
+
+// AssignPlan puts a company on the named plan, or back on the default plan
+// when planName is empty
+func (ps *RateLimitPlanService) AssignPlan(ctx context.Context, companyID, planName string) (*TenantLimits, error) {
+	var planID *uuid.UUID
+	if planName != "" {
+		plan, err := ps.findPlan(ctx, planName)
+		if err != nil {
+			return nil, err
+		}
+		planID = &plan.ID
+	}
+
+	result := ps.db.WithContext(ctx).Model(&models.Company{}).
+		Where("company_id = ?", companyID).
+		Update("rate_limit_plan_id", planID)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to assign rate limit plan: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCompanyNotFound
+	}
+
+	// The cached company carries its plan too
+	if err := ps.cache.InvalidateTags(ctx, CompanyTag(companyID)); err != nil {
+		ps.logger.WarnContext(ctx, "Failed to invalidate company cache", "company_id", companyID, "error", err)
+	}
+
+	ps.logger.InfoContext(ctx, "Assigned rate limit plan", "company_id", companyID, "plan", planName)
+	return ps.LimitsForCompany(ctx, companyID)
+}
+
+// LimitsForCompany returns the limits that apply to a company. Unknown
+// companies get the default limits.
+func (ps *RateLimitPlanService) LimitsForCompany(ctx context.Context, companyID string) (*TenantLimits, error) {
+	cacheKey := fmt.Sprintf("plan:%s", companyID)
+	tags := []string{CompanyTag(companyID), rateLimitPlansTag}
+	return GetOrLoad(ctx, ps.cache, cacheKey, tenantLimitsTTL, tags, func(ctx context.Context) (*TenantLimits, error) {
+		var company models.Company
+		err := ps.db.WithContext(ctx).Select("rate_limit_plan_id").Where("company_id = ?", companyID).First(&company).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to load company rate limit plan: %w", err)
+		}
+
+		var plan models.RateLimitPlan
+		query := ps.db.WithContext(ctx)
+		if company.RateLimitPlanID != nil {
+			query = query.Where("id = ?", *company.RateLimitPlanID)
+		} else {
+			query = query.Where("name = ?", DefaultPlanName)
+		}
+		err = query.First(&plan).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ps.limiter.DefaultLimits(), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load rate limit plan: %w", err)
+		}
+
+		return &TenantLimits{
+			Plan:       plan.Name,
+			Limit:      ps.limiter.WindowLimit(plan.RequestsPerSecond),
+			Burst:      plan.Burst,
+			DailyQuota: plan.DailyQuota,
+		}, nil
+	})
+}
+
+// Usage reports a company's limits, the requests in its current rate limit
+// window and its requests per day for the retained days
+func (ps *RateLimitPlanService) Usage(ctx context.Context, companyID string) (*TenantUsage, error) {
+	var count int64
+	if err := ps.db.WithContext(ctx).Model(&models.Company{}).Where("company_id = ?", companyID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check company: %w", err)
+	}
+	if count == 0 {
+		return nil, ErrCompanyNotFound
+	}
+
+	limits, err := ps.LimitsForCompany(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := TenantRateLimitKey(companyID)
+	windowRequests, err := ps.limiter.WindowCount(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rate limit window: %w", err)
+	}
+	daily, err := ps.limiter.DailyUsage(ctx, key, quotaRetentionDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read daily usage: %w", err)
+	}
+
+	return &TenantUsage{
+		CompanyID:      companyID,
+		Limits:         limits,
+		WindowSeconds:  ps.limiter.Window().Seconds(),
+		WindowRequests: windowRequests,
+		Daily:          daily,
+	}, nil
+}
+
+func (ps *RateLimitPlanService) findPlan(ctx context.Context, name string) (*models.RateLimitPlan, error) {
+	var plan models.RateLimitPlan
+	err := ps.db.WithContext(ctx).Where("name = ?", name).First(&plan).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPlanNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load rate limit plan: %w", err)
+	}
+	return &plan, nil
+}
+
+// invalidateLimits drops every cached tenant limit
+func (ps *RateLimitPlanService) invalidateLimits(ctx context.Context) {
+	if err := ps.cache.InvalidateTags(ctx, rateLimitPlansTag); err != nil {
+		ps.logger.WarnContext(ctx, "Failed to invalidate cached rate limits", "error", err)
+	}
+}
+
+func validatePlan(plan *models.RateLimitPlan) error {
+	switch {
+	case plan.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidPlan)
+	case plan.RequestsPerSecond <= 0:
+		return fmt.Errorf("%w: requests_per_second must be positive", ErrInvalidPlan)
+	case plan.Burst < 0:
+		return fmt.Errorf("%w: burst must not be negative", ErrInvalidPlan)
+	case plan.DailyQuota < 0:
+		return fmt.Errorf("%w: daily_quota must not be negative", ErrInvalidPlan)
+	}
+	return nil
+}
\ No newline at end of file
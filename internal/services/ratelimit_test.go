@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	"marketplace-app/internal/config"
+	"marketplace-app/internal/models"
+)
+
+func newTestRateLimiter(t *testing.T, cache *CacheService) *RateLimiter {
+	t.Helper()
+
+	return NewRateLimiter(&config.Config{
+		CacheKeyPrefix:   "test:",
+		RateLimitRPS:     1,
+		RateLimitWindow:  3 * time.Second,
+		RateLimitEnabled: true,
+	}, cache, testLogger)
+}
+
+func TestRateLimiterRedis(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	rl := newTestRateLimiter(t, newTestCache(t, mr.Addr(), "limiter", 0))
+	if rl.Limit() != 3 {
+		t.Fatalf("got limit %d, want RPS times window seconds", rl.Limit())
+	}
+
+	for i := 0; i < 3; i++ {
+		result := rl.Allow(ctx, "ip:1.2.3.4", rl.Limit())
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("request %d: got %+v, want allowed with %d remaining", i+1, result, 2-i)
+		}
+	}
+
+	result := rl.Allow(ctx, "ip:1.2.3.4", rl.Limit())
+	if result.Allowed || result.Remaining != 0 {
+		t.Errorf("got %+v, want the fourth request rejected", result)
+	}
+	if result.Reset <= 0 || result.Reset > 3*time.Second {
+		t.Errorf("got reset %v, want within the window", result.Reset)
+	}
+	if !mr.Exists("test:rate_limit:ip:1.2.3.4") {
+		t.Error("expected the window under the namespaced rate_limit key")
+	}
+
+	if result := rl.Allow(ctx, "tenant:company-1", rl.Limit()); !result.Allowed {
+		t.Errorf("got %+v, want another key limited separately", result)
+	}
+}
+
+func TestRateLimiterMemorySlides(t *testing.T) {
+	rl := newTestRateLimiter(t, nil)
+	start := time.Now()
+	window := []RateWindow{{Key: "ip:1.2.3.4", Limit: 3, Window: 3 * time.Second}}
+
+	for i := 0; i < 3; i++ {
+		if result := rl.allowMemory(window, start.Add(time.Duration(i)*time.Second)); !result.Allowed {
+			t.Fatalf("request %d rejected: %+v", i+1, result)
+		}
+	}
+	if result := rl.allowMemory(window, start.Add(2500*time.Millisecond)); result.Allowed {
+		t.Fatal("expected a request over the limit to be rejected")
+	}
+
+	// Once the first request leaves the window one more is admitted, but not two
+	later := start.Add(3100 * time.Millisecond)
+	if result := rl.allowMemory(window, later); !result.Allowed {
+		t.Errorf("got %+v, want a slot freed by the sliding window", result)
+	}
+	if result := rl.allowMemory(window, later); result.Allowed {
+		t.Errorf("got %+v, want the window full again", result)
+	}
+
+	// Quiet clients are dropped
+	rl.allowMemory([]RateWindow{{Key: "ip:5.6.7.8", Limit: 3, Window: 3 * time.Second}}, start.Add(time.Minute))
+	if _, ok := rl.windows["ip:1.2.3.4"]; ok {
+		t.Error("expected the idle window to be swept")
+	}
+}
+
+func TestRateLimiterTenantPlan(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	limiters := map[string]*RateLimiter{
+		"redis":  newTestRateLimiter(t, newTestCache(t, mr.Addr(), "plans", 0)),
+		"memory": newTestRateLimiter(t, nil),
+	}
+
+	for name, rl := range limiters {
+		t.Run(name, func(t *testing.T) {
+			// Ten requests per window, but at most two in any second
+			limits := &TenantLimits{Plan: "pro", Limit: 10, Burst: 2, DailyQuota: 3}
+			windows := rl.TenantWindows("company-1", limits)
+
+			for i := 0; i < 2; i++ {
+				if result := rl.AllowWindows(ctx, windows...); !result.Allowed || result.Limit != 10 {
+					t.Fatalf("request %d: got %+v, want admitted against the window", i+1, result)
+				}
+			}
+			result := rl.AllowWindows(ctx, windows...)
+			if result.Allowed || result.Limit != 2 || result.Reset > time.Second {
+				t.Fatalf("got %+v, want refused by the burst limit", result)
+			}
+			if count, _ := rl.WindowCount(ctx, TenantRateLimitKey("company-1")); count != 2 {
+				t.Errorf("window holds %d requests, want the refused one left out", count)
+			}
+
+			for i := 1; i <= 3; i++ {
+				quota := rl.ConsumeTenantQuota(ctx, "company-1", limits)
+				if !quota.Allowed || quota.Used != int64(i) || quota.Remaining() != int64(3-i) {
+					t.Fatalf("request %d: got quota %+v", i, quota)
+				}
+			}
+			if quota := rl.ConsumeTenantQuota(ctx, "company-1", limits); quota.Allowed || quota.Remaining() != 0 {
+				t.Errorf("got quota %+v, want the fourth request refused", quota)
+			}
+
+			usage, err := rl.DailyUsage(ctx, TenantRateLimitKey("company-1"), quotaRetentionDays)
+			if err != nil {
+				t.Fatalf("DailyUsage: %v", err)
+			}
+			if len(usage) != quotaRetentionDays || usage[0].Requests != 3 || usage[1].Requests != 0 {
+				t.Errorf("got usage %+v, want 3 requests today", usage)
+			}
+		})
+	}
+}
+
+func TestRateLimiterRefundQuota(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	limiters := map[string]*RateLimiter{
+		"redis":  newTestRateLimiter(t, newTestCache(t, mr.Addr(), "refund", 0)),
+		"memory": newTestRateLimiter(t, nil),
+	}
+
+	for name, rl := range limiters {
+		t.Run(name, func(t *testing.T) {
+			limits := &TenantLimits{Plan: "trial", Limit: 10, DailyQuota: 1}
+
+			// A request refused after passing the quota gives it back
+			quota := rl.ConsumeTenantQuota(ctx, "company-1", limits)
+			if !quota.Allowed {
+				t.Fatalf("got quota %+v, want the first request admitted", quota)
+			}
+			if refunded := rl.RefundQuota(ctx, quota); refunded.Allowed || refunded.Remaining() != 1 {
+				t.Errorf("got refunded quota %+v, want one request remaining", refunded)
+			}
+			if quota := rl.ConsumeTenantQuota(ctx, "company-1", limits); !quota.Allowed {
+				t.Fatalf("got quota %+v, want the refunded request available again", quota)
+			}
+
+			// Refusals were never counted, so there is nothing to refund
+			refused := rl.ConsumeTenantQuota(ctx, "company-1", limits)
+			if refused.Allowed {
+				t.Fatalf("got quota %+v, want the quota exhausted", refused)
+			}
+			rl.RefundQuota(ctx, refused)
+
+			usage, err := rl.DailyUsage(ctx, TenantRateLimitKey("company-1"), 1)
+			if err != nil {
+				t.Fatalf("DailyUsage: %v", err)
+			}
+			if usage[0].Requests != 1 {
+				t.Errorf("got %d requests today, want only the admitted one", usage[0].Requests)
+			}
+		})
+	}
+}
+
+func TestCreatePlanExists(t *testing.T) {
+	db, mock := newTestDB(t)
+	ps := NewRateLimitPlanService(db, nil, nil, testLogger)
+
+	// A plan created concurrently under the same name trips the unique index
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "rate_limit_plans"`).
+		WillReturnError(&pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"})
+	mock.ExpectRollback()
+
+	plan := &models.RateLimitPlan{Name: "pro", RequestsPerSecond: 10}
+	if err := ps.CreatePlan(context.Background(), plan); !errors.Is(err, ErrPlanExists) {
+		t.Fatalf("got %v, want ErrPlanExists", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
\ No newline at end of file
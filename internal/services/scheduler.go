@@ -1,30 +1,65 @@
 package services
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"marketplace-app/internal/models"
+	"marketplace-app/internal/telemetry"
+)
+
+// cronParser matches the seconds-precision parser used by the scheduler
+var cronParser = cron.NewParser(
+	cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
 )
 
 type SchedulerService struct {
-	cron        *cron.Cron
+	cron         *cron.Cron
+	db           *gorm.DB
 	tokenService *TokenService
-	isRunning   bool
+	locks        *LockService
+	alerts       *AlertService
+	jobTypes     map[string]JobFunc
+	isRunning    bool
+	stopSync     chan struct{}
+	// jobCtx is cancelled when Stop gives up waiting for running jobs
+	jobCtx     context.Context
+	cancelJobs context.CancelFunc
+	logger     *slog.Logger
+
+	mu   sync.Mutex
+	jobs map[string]*scheduledJob
 }
 
-func NewSchedulerService(tokenService *TokenService) *SchedulerService {
+func NewSchedulerService(db *gorm.DB, tokenService *TokenService, locks *LockService, alerts *AlertService, logger *slog.Logger) *SchedulerService {
 	// Create cron with seconds precision and logging
 	c := cron.New(
 		cron.WithSeconds(),
-		cron.WithLogger(cron.VerbosePrintfLogger(log.New(log.Writer(), "CRON: ", log.LstdFlags))),
+		cron.WithLogger(cronLogger{logger: logger.With("component", "cron")}),
 	)
 
-	return &SchedulerService{
+	ss := &SchedulerService{
 		cron:         c,
+		db:           db,
 		tokenService: tokenService,
+		locks:        locks,
+		alerts:       alerts,
+		logger:       logger,
 		isRunning:    false,
+		jobs:         make(map[string]*scheduledJob),
 	}
+	ss.registerJobTypes()
+
+	return ss
 }
 
 // Start initializes and starts all scheduled jobs
@@ -33,71 +68,49 @@ func (ss *SchedulerService) Start() error {
 		return nil
 	}
 
-	// Schedule token refresh job - runs every hour
-	_, err := ss.cron.AddFunc("0 0 * * * *", func() {
-		log.Println("Running scheduled token refresh job")
-		if err := ss.tokenService.RefreshExpiredTokens(); err != nil {
-			log.Printf("Token refresh job failed: %v", err)
-		}
-	})
-	if err != nil {
+	// Seed the built-in jobs on first run, then schedule every persisted job
+	if err := ss.seedDefaultJobs(); err != nil {
 		return err
 	}
-
-	// Schedule token cleanup job - runs daily at 2 AM
-	_, err = ss.cron.AddFunc("0 0 2 * * *", func() {
-		log.Println("Running scheduled token cleanup job")
-		if err := ss.tokenService.CleanupExpiredTokens(); err != nil {
-			log.Printf("Token cleanup job failed: %v", err)
-		}
-	})
-	if err != nil {
-		return err
-	}
-
-	// Schedule health check job - runs every 5 minutes
-	_, err = ss.cron.AddFunc("0 */5 * * * *", func() {
-		ss.performHealthCheck()
-	})
-	if err != nil {
-		return err
-	}
-
-	// Schedule token status monitoring - runs every 30 minutes
-	_, err = ss.cron.AddFunc("0 */30 * * * *", func() {
-		ss.monitorTokenStatuses()
-	})
-	if err != nil {
+	if err := ss.syncJobs(); err != nil {
 		return err
 	}
 
 	// Start the cron scheduler
+	ss.mu.Lock()
+	ss.jobCtx, ss.cancelJobs = context.WithCancel(context.Background())
+	ss.mu.Unlock()
 	ss.cron.Start()
+	ss.stopSync = make(chan struct{})
+	go ss.syncLoop(ss.stopSync)
 	ss.isRunning = true
 
-	log.Println("Scheduler service started successfully")
+	ss.logger.Info("Scheduler service started")
 	return nil
 }
 
-// Stop gracefully stops the scheduler
-func (ss *SchedulerService) Stop() {
+// Stop stops scheduling new runs and waits for running jobs to complete.
+// If ctx ends first, the running jobs' context is cancelled.
+func (ss *SchedulerService) Stop(ctx context.Context) {
 	if !ss.isRunning {
 		return
 	}
 
-	log.Println("Stopping scheduler service...")
-	ctx := ss.cron.Stop()
-	
-	// Wait for running jobs to complete with timeout
+	ss.logger.Info("Stopping scheduler service")
+	close(ss.stopSync)
+	done := ss.cron.Stop()
+
+	// Wait for running jobs to complete until the shutdown deadline
 	select {
+	case <-done.Done():
+		ss.logger.Info("All scheduled jobs completed")
 	case <-ctx.Done():
-		log.Println("All scheduled jobs completed")
-	case <-time.After(30 * time.Second):
-		log.Println("Timeout waiting for jobs to complete")
+		ss.logger.Warn("Timeout waiting for jobs to complete, cancelling running jobs")
 	}
+	ss.cancelJobs()
 
 	ss.isRunning = false
-	log.Println("Scheduler service stopped")
+	ss.logger.Info("Scheduler service stopped")
 }
 
 // AddJob adds a custom job to the scheduler
@@ -121,25 +134,136 @@ func (ss *SchedulerService) IsRunning() bool {
 }
 
 // RunTokenRefreshNow manually triggers token refresh job
-func (ss *SchedulerService) RunTokenRefreshNow() error {
-	log.Println("Manually triggering token refresh job")
-	return ss.tokenService.RefreshExpiredTokens()
+func (ss *SchedulerService) RunTokenRefreshNow(ctx context.Context) error {
+	ss.logger.InfoContext(ctx, "Manually triggering token refresh job")
+	_, err := ss.tokenService.RefreshExpiredTokens(ctx)
+	return err
 }
 
 // RunCleanupNow manually triggers cleanup job
-func (ss *SchedulerService) RunCleanupNow() error {
-	log.Println("Manually triggering token cleanup job")
-	return ss.tokenService.CleanupExpiredTokens()
+func (ss *SchedulerService) RunCleanupNow(ctx context.Context) error {
+	ss.logger.InfoContext(ctx, "Manually triggering token cleanup job")
+	_, err := ss.tokenService.CleanupExpiredTokens(ctx, defaultCleanupDays)
+	return err
 }
 
 // Private helper methods
 
-func (ss *SchedulerService) performHealthCheck() {
+// exclusive wraps a scheduled job so each tick runs on only one instance.
+// The tick claim is not released when the job finishes; it expires with its
+// lease so that replicas whose cron fires a moment later still see it held.
+func (ss *SchedulerService) exclusive(job models.SchedulerJob, lease time.Duration, cmd jobCommand) func() {
+	name := job.Name
+	return func() {
+		ss.mu.Lock()
+		ctx := ss.jobCtx
+		ss.mu.Unlock()
+
+		_, err := ss.locks.TryAcquire(ctx, schedulerLockName(name), lease)
+		if errors.Is(err, ErrLockHeld) {
+			ss.logger.DebugContext(ctx, "Skipping job: tick already claimed by another instance", "job", name)
+			return
+		}
+		if err != nil {
+			ss.logger.WarnContext(ctx, "Skipping job: failed to acquire lock", "job", name, "error", err)
+			return
+		}
+
+		ss.logger.InfoContext(ctx, "Running scheduled job", "job", name)
+		err = ss.runLocked(ctx, job, JobTriggerScheduled, 2*lease, cmd)
+		if errors.Is(err, ErrJobRunning) {
+			ss.logger.WarnContext(ctx, "Skipping job: a previous run is still in progress", "job", name)
+			return
+		}
+		if err != nil {
+			ss.logger.ErrorContext(ctx, "Scheduled job failed", "job", name, "error", err)
+		}
+	}
+}
+
+// runLocked runs cmd while holding the job's running lock, which unlike the
+// tick claim is released as soon as the run completes. The lock is renewed
+// for as long as cmd runs, so a run that outlasts lease still excludes the
+// next one, and cmd is cancelled if the lock is lost. Every attempt is
+// recorded in the job run history.
+func (ss *SchedulerService) runLocked(ctx context.Context, job models.SchedulerJob, trigger string, lease time.Duration, cmd jobCommand) error {
+	ctx, span := telemetry.Tracer().Start(ctx, "scheduler.job "+job.Name, trace.WithAttributes(
+		attribute.String("job.type", job.JobType),
+		attribute.String("job.trigger", trigger),
+	))
+	defer span.End()
+
+	run := &models.SchedulerJobRun{
+		JobName:    job.Name,
+		JobType:    job.JobType,
+		Trigger:    trigger,
+		InstanceID: ss.locks.InstanceID(),
+		StartedAt:  time.Now(),
+	}
+
+	lock, err := ss.locks.TryAcquire(ctx, schedulerRunningLockName(job.Name), lease)
+	if errors.Is(err, ErrLockHeld) {
+		ss.recordRun(run, JobRunSkipped, 0, ErrJobRunning)
+		return ErrJobRunning
+	}
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer ss.locks.Release(context.Background(), lock)
+	ctx, stopRenewing := ss.locks.Hold(ctx, lock, lease)
+	defer stopRenewing()
+
+	items, err := cmd(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		ss.recordRun(run, JobRunFailed, items, err)
+		return err
+	}
+
+	ss.recordRun(run, JobRunSucceeded, items, nil)
+	return nil
+}
+
+// jobLease returns how long a tick claim is held: half the schedule interval
+func jobLease(spec string) (time.Duration, error) {
+	interval, err := scheduleInterval(spec)
+	if err != nil {
+		return 0, err
+	}
+
+	lease := interval / 2
+	if lease < time.Second {
+		lease = time.Second
+	}
+
+	return lease, nil
+}
+
+// scheduleInterval returns the gap between the next two activations of spec
+func scheduleInterval(spec string) (time.Duration, error) {
+	schedule, err := cronParser.Parse(spec)
+	if err != nil {
+		return 0, err
+	}
+
+	next := schedule.Next(time.Now())
+	return schedule.Next(next).Sub(next), nil
+}
+
+func schedulerLockName(job string) string {
+	return "scheduler:" + job
+}
+
+func schedulerRunningLockName(job string) string {
+	return "scheduler:" + job + ":running"
+}
+
+func (ss *SchedulerService) performHealthCheck(ctx context.Context) (int, error) {
 	// Get all token statuses
-	statuses, err := ss.tokenService.GetAllTokenStatuses()
+	statuses, err := ss.tokenService.GetAllTokenStatuses(ctx)
 	if err != nil {
-		log.Printf("Health check failed to get token statuses: %v", err)
-		return
+		return 0, fmt.Errorf("health check failed to get token statuses: %w", err)
 	}
 
 	expiredCount := 0
@@ -156,28 +280,53 @@ func (ss *SchedulerService) performHealthCheck() {
 		}
 	}
 
-	log.Printf("Health Check - Active: %d, Needs Refresh: %d, Expired: %d", 
-		activeCount, needsRefreshCount, expiredCount)
+	ss.logger.InfoContext(ctx, "Token health check",
+		"active", activeCount, "needs_refresh", needsRefreshCount, "expired", expiredCount)
 
 	// Alert if too many tokens are expired
 	if expiredCount > 0 {
-		log.Printf("WARNING: %d companies have expired tokens", expiredCount)
+		ss.logger.WarnContext(ctx, "Companies have expired tokens", "count", expiredCount)
+		ss.alerts.Fire(ctx, Alert{
+			Key:      expiredTokensAlertKey,
+			Severity: AlertSeverityWarning,
+			Title:    "Companies with expired tokens",
+			Message:  fmt.Sprintf("%d companies have expired tokens", expiredCount),
+		})
+	} else {
+		ss.alerts.Resolve(ctx, expiredTokensAlertKey, "Companies with expired tokens",
+			"No companies have expired tokens")
 	}
 
 	// Alert if too many tokens need refresh
 	if needsRefreshCount > 5 {
-		log.Printf("INFO: %d companies need token refresh soon", needsRefreshCount)
+		ss.logger.InfoContext(ctx, "Companies need token refresh soon", "count", needsRefreshCount)
+	}
+
+	// Flag scheduled jobs that overran their interval or keep failing
+	jobHealth, err := ss.GetJobHealth(ctx, defaultStaleCycles)
+	if err != nil {
+		ss.logger.ErrorContext(ctx, "Health check failed to evaluate scheduler jobs", "error", err)
 	}
+	for _, health := range jobHealth {
+		if health.Overran {
+			ss.logger.WarnContext(ctx, "Job ran longer than its interval", "job", health.Name,
+				"duration_ms", health.LastDurationMs, "interval_seconds", health.IntervalSeconds)
+		}
+		if health.Stale {
+			ss.logger.WarnContext(ctx, "Job has not succeeded recently", "job", health.Name, "cycles", defaultStaleCycles)
+		}
+	}
+
+	return len(statuses), nil
 }
 
-func (ss *SchedulerService) monitorTokenStatuses() {
-	log.Println("Running token status monitoring")
+func (ss *SchedulerService) monitorTokenStatuses(ctx context.Context) (int, error) {
+	ss.logger.InfoContext(ctx, "Running token status monitoring")
 
-	// Get companies with tokens expiring in the next 48 hours
-	statuses, err := ss.tokenService.GetAllTokenStatuses()
+	// Get token statuses, classified by each provider's warning and critical thresholds
+	statuses, err := ss.tokenService.GetAllTokenStatuses(ctx)
 	if err != nil {
-		log.Printf("Token monitoring failed: %v", err)
-		return
+		return 0, fmt.Errorf("token monitoring failed: %w", err)
 	}
 
 	criticalCount := 0
@@ -186,31 +335,76 @@ func (ss *SchedulerService) monitorTokenStatuses() {
 	for _, status := range statuses {
 		if status.IsExpired {
 			criticalCount++
-			log.Printf("CRITICAL: Token expired for company %s (%s)", 
-				status.CompanyID, status.CompanyName)
-		} else if status.TimeToExpiry < 24*time.Hour {
+			ss.logger.ErrorContext(ctx, "Token expired",
+				"company_id", status.CompanyID, "company_name", status.CompanyName)
+			ss.alerts.Fire(ctx, tokenExpiryAlert(status, AlertSeverityCritical,
+				fmt.Sprintf("Token expired for company %s (%s)", status.CompanyID, status.CompanyName)))
+		} else if status.Severity == AlertSeverityCritical {
 			criticalCount++
-			log.Printf("CRITICAL: Token expires in %v for company %s (%s)", 
-				status.TimeToExpiry, status.CompanyID, status.CompanyName)
-		} else if status.TimeToExpiry < 48*time.Hour {
+			ss.logger.ErrorContext(ctx, "Token expiring soon", "company_id", status.CompanyID,
+				"company_name", status.CompanyName, "time_to_expiry", status.TimeToExpiry.String())
+			ss.alerts.Fire(ctx, tokenExpiryAlert(status, AlertSeverityCritical,
+				fmt.Sprintf("Token expires in %v for company %s (%s)", status.TimeToExpiry.Round(time.Minute), status.CompanyID, status.CompanyName)))
+		} else if status.Severity == AlertSeverityWarning {
 			warningCount++
-			log.Printf("WARNING: Token expires in %v for company %s (%s)", 
-				status.TimeToExpiry, status.CompanyID, status.CompanyName)
+			ss.logger.WarnContext(ctx, "Token expiring", "company_id", status.CompanyID,
+				"company_name", status.CompanyName, "time_to_expiry", status.TimeToExpiry.String())
+			ss.alerts.Fire(ctx, tokenExpiryAlert(status, AlertSeverityWarning,
+				fmt.Sprintf("Token expires in %v for company %s (%s)", status.TimeToExpiry.Round(time.Minute), status.CompanyID, status.CompanyName)))
+		} else {
+			ss.alerts.Resolve(ctx, TokenExpiryAlertKey(status.CompanyID), tokenExpiryAlertTitle,
+				fmt.Sprintf("Token for company %s (%s) is valid until %s", status.CompanyID, status.CompanyName, status.TokenExpiry.Format(time.RFC3339)))
 		}
 	}
 
 	if criticalCount > 0 || warningCount > 0 {
-		log.Printf("Token Status Summary - Critical: %d, Warning: %d", 
-			criticalCount, warningCount)
+		ss.logger.InfoContext(ctx, "Token status summary", "critical", criticalCount, "warning", warningCount)
+	}
+
+	return len(statuses), nil
+}
+
+// cronLogger writes the cron library's logs through slog. Its routine
+// scheduling messages are debug output.
+type cronLogger struct {
+	logger *slog.Logger
+}
+
+func (cl cronLogger) Info(msg string, keysAndValues ...interface{}) {
+	cl.logger.Debug(msg, keysAndValues...)
+}
+
+func (cl cronLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	cl.logger.Error(msg, append(keysAndValues, "error", err)...)
+}
+
+// expiredTokensAlertKey is the dedup key for the expired token summary alert
+const expiredTokensAlertKey = "token_health:expired"
+
+const tokenExpiryAlertTitle = "Company token expiring"
+
+func tokenExpiryAlert(status TokenExpiryInfo, severity, message string) Alert {
+	return Alert{
+		Key:       TokenExpiryAlertKey(status.CompanyID),
+		Severity:  severity,
+		Title:     tokenExpiryAlertTitle,
+		Message:   message,
+		CompanyID: status.CompanyID,
+		Labels: map[string]string{
+			"company_name": status.CompanyName,
+			"token_expiry": status.TokenExpiry.Format(time.RFC3339),
+		},
 	}
 }
 
 // SchedulerStats provides statistics about the scheduler
 type SchedulerStats struct {
-	IsRunning    bool `json:"is_running"`
-	JobCount     int  `json:"job_count"`
-	NextJobTime  *time.Time `json:"next_job_time,omitempty"`
-	LastJobTime  *time.Time `json:"last_job_time,omitempty"`
+	IsRunning   bool       `json:"is_running"`
+	JobCount    int        `json:"job_count"`
+	NextJobTime *time.Time `json:"next_job_time,omitempty"`
+	LastJobTime *time.Time `json:"last_job_time,omitempty"`
+	InstanceID  string     `json:"instance_id,omitempty"`
+	Locks       []LockInfo `json:"locks,omitempty"`
 }
 
 // GetStats returns scheduler statistics
@@ -244,5 +438,14 @@ func (ss *SchedulerService) GetStats() SchedulerStats {
 		}
 	}
 
+	// Report which instance claimed the last tick and which is running each job
+	stats.InstanceID = ss.locks.InstanceID()
+	for _, name := range ss.jobNamesSorted() {
+		stats.Locks = append(stats.Locks,
+			ss.locks.Holder(context.Background(), schedulerLockName(name)),
+			ss.locks.Holder(context.Background(), schedulerRunningLockName(name)),
+		)
+	}
+
 	return stats
 }
\ No newline at end of file
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"marketplace-app/internal/models"
+)
+
+// JobFunc implements a scheduler job type and returns the number of items it processed
+type JobFunc func(ctx context.Context, params models.JSONMap) (int, error)
+
+// jobCommand is a JobFunc bound to a job's parameters
+type jobCommand func(ctx context.Context) (int, error)
+
+var (
+	// ErrJobNotFound is returned when no job exists with the given name
+	ErrJobNotFound = errors.New("scheduler job not found")
+	// ErrJobExists is returned when creating a job whose name is taken
+	ErrJobExists = errors.New("scheduler job already exists")
+	// ErrInvalidJob is returned when a job definition fails validation
+	ErrInvalidJob = errors.New("invalid scheduler job")
+	// ErrJobRunning is returned when a job is already running somewhere
+	ErrJobRunning = errors.New("scheduler job is already running")
+)
+
+// Job types understood by the scheduler
+const (
+	JobTypeTokenRefresh = "token_refresh"
+	JobTypeTokenCleanup = "token_cleanup"
+	JobTypeHealthCheck  = "health_check"
+	JobTypeTokenMonitor = "token_monitor"
+	JobTypeRunCleanup   = "job_run_cleanup"
+)
+
+// defaultCleanupDays is how old failed/expired token records must be before cleanup
+const defaultCleanupDays = 30
+
+// jobSyncInterval controls how often job definitions are reloaded from the
+// database, so changes made through another replica take effect here too
+const jobSyncInterval = 30 * time.Second
+
+// defaultSchedulerJobs are seeded by name unless a job of that name exists or
+// was deleted
+var defaultSchedulerJobs = []models.SchedulerJob{
+	{Name: "token_refresh", Spec: "0 0 * * * *", JobType: JobTypeTokenRefresh, Enabled: true},
+	{Name: "token_cleanup", Spec: "0 0 2 * * *", JobType: JobTypeTokenCleanup, Enabled: true,
+		Parameters: models.JSONMap{"older_than_days": defaultCleanupDays}},
+	{Name: "health_check", Spec: "0 */5 * * * *", JobType: JobTypeHealthCheck, Enabled: true},
+	{Name: "token_monitor", Spec: "0 */30 * * * *", JobType: JobTypeTokenMonitor, Enabled: true},
+	{Name: "job_run_cleanup", Spec: "0 30 2 * * *", JobType: JobTypeRunCleanup, Enabled: true,
+		Parameters: models.JSONMap{"older_than_days": defaultRunRetentionDays}},
+}
+
+// scheduledJob tracks a job definition and its cron entry (zero when paused)
+type scheduledJob struct {
+	def     models.SchedulerJob
+	entryID cron.EntryID
+}
+
+// SchedulerJobStatus is a job definition together with its schedule state
+type SchedulerJobStatus struct {
+	models.SchedulerJob
+	Scheduled bool       `json:"scheduled"`
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+}
+
+// SchedulerJobUpdate holds the mutable fields of a job definition
+type SchedulerJobUpdate struct {
+	Spec       *string        `json:"spec"`
+	JobType    *string        `json:"job_type"`
+	Enabled    *bool          `json:"enabled"`
+	Parameters models.JSONMap `json:"parameters"`
+}
+
+// JobTypes returns the names of all registered job types
+func (ss *SchedulerService) JobTypes() []string {
+	types := make([]string, 0, len(ss.jobTypes))
+	for jobType := range ss.jobTypes {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ListJobs returns all persisted jobs with their schedule state
+func (ss *SchedulerService) ListJobs(ctx context.Context) ([]SchedulerJobStatus, error) {
+	var defs []models.SchedulerJob
+	if err := ss.db.WithContext(ctx).Order("name").Find(&defs).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch scheduler jobs: %w", err)
+	}
+
+	statuses := make([]SchedulerJobStatus, 0, len(defs))
+	for _, def := range defs {
+		statuses = append(statuses, ss.jobStatus(def))
+	}
+
+	return statuses, nil
+}
+
+// GetJob returns a single job by name
+func (ss *SchedulerService) GetJob(ctx context.Context, name string) (*SchedulerJobStatus, error) {
+	def, err := ss.findJob(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	status := ss.jobStatus(*def)
+	return &status, nil
+}
+
+// CreateJob persists a new job and schedules it if enabled
+func (ss *SchedulerService) CreateJob(ctx context.Context, job *models.SchedulerJob) error {
+	if err := ss.validateJob(job); err != nil {
+		return err
+	}
+
+	// A deleted job of the same name gives up its row to the new one; the
+	// unique index on name refuses a job that exists, even one created
+	// concurrently
+	err := ss.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("name = ? AND deleted_at IS NOT NULL", job.Name).Delete(&models.SchedulerJob{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(job).Error
+	})
+	if isUniqueViolation(err) {
+		return ErrJobExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create scheduler job: %w", err)
+	}
+
+	return ss.syncJobs()
+}
+
+// UpdateJob applies changes to a job and reschedules it
+func (ss *SchedulerService) UpdateJob(ctx context.Context, name string, update SchedulerJobUpdate) (*models.SchedulerJob, error) {
+	job, err := ss.findJob(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Spec != nil {
+		job.Spec = *update.Spec
+	}
+	if update.JobType != nil {
+		job.JobType = *update.JobType
+	}
+	if update.Enabled != nil {
+		job.Enabled = *update.Enabled
+	}
+	if update.Parameters != nil {
+		job.Parameters = update.Parameters
+	}
+
+	if err := ss.validateJob(job); err != nil {
+		return nil, err
+	}
+
+	if err := ss.db.WithContext(ctx).Save(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to update scheduler job: %w", err)
+	}
+
+	return job, ss.syncJobs()
+}
+
+// SetJobEnabled pauses or resumes a job
+func (ss *SchedulerService) SetJobEnabled(ctx context.Context, name string, enabled bool) (*models.SchedulerJob, error) {
+	return ss.UpdateJob(ctx, name, SchedulerJobUpdate{Enabled: &enabled})
+}
+
+// DeleteJob unschedules and removes a job
+func (ss *SchedulerService) DeleteJob(ctx context.Context, name string) error {
+	result := ss.db.WithContext(ctx).Where("name = ?", name).Delete(&models.SchedulerJob{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete scheduler job: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrJobNotFound
+	}
+
+	return ss.syncJobs()
+}
+
+// RunJobNow runs a job immediately, regardless of its schedule or paused state.
+// It returns ErrJobRunning if the job is currently running on any instance.
+func (ss *SchedulerService) RunJobNow(ctx context.Context, name string) error {
+	job, err := ss.findJob(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	run, ok := ss.jobTypes[job.JobType]
+	if !ok {
+		return fmt.Errorf("%w: unknown job type %q", ErrInvalidJob, job.JobType)
+	}
+
+	lease, err := jobLease(job.Spec)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+
+	ss.logger.InfoContext(ctx, "Manually triggering job", "job", name)
+	params := job.Parameters
+	return ss.runLocked(ctx, *job, JobTriggerManual, 2*lease, func(ctx context.Context) (int, error) {
+		return run(ctx, params)
+	})
+}
+
+// Private helper methods
+
+func (ss *SchedulerService) registerJobTypes() {
+	ss.jobTypes = map[string]JobFunc{
+		JobTypeTokenRefresh: func(ctx context.Context, params models.JSONMap) (int, error) {
+			return ss.tokenService.RefreshExpiredTokens(ctx)
+		},
+		JobTypeTokenCleanup: func(ctx context.Context, params models.JSONMap) (int, error) {
+			deleted, err := ss.tokenService.CleanupExpiredTokens(ctx, intParam(params, "older_than_days", defaultCleanupDays))
+			return int(deleted), err
+		},
+		JobTypeHealthCheck: func(ctx context.Context, params models.JSONMap) (int, error) {
+			return ss.performHealthCheck(ctx)
+		},
+		JobTypeTokenMonitor: func(ctx context.Context, params models.JSONMap) (int, error) {
+			return ss.monitorTokenStatuses(ctx)
+		},
+		JobTypeRunCleanup: func(ctx context.Context, params models.JSONMap) (int, error) {
+			deleted, err := ss.CleanupJobRuns(ctx, intParam(params, "older_than_days", defaultRunRetentionDays))
+			return int(deleted), err
+		},
+	}
+}
+
+func (ss *SchedulerService) validateJob(job *models.SchedulerJob) error {
+	if job.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidJob)
+	}
+	if _, ok := ss.jobTypes[job.JobType]; !ok {
+		return fmt.Errorf("%w: unknown job type %q", ErrInvalidJob, job.JobType)
+	}
+	if _, err := cronParser.Parse(job.Spec); err != nil {
+		return fmt.Errorf("%w: invalid spec %q: %v", ErrInvalidJob, job.Spec, err)
+	}
+	return nil
+}
+
+func (ss *SchedulerService) findJob(ctx context.Context, name string) (*models.SchedulerJob, error) {
+	job := &models.SchedulerJob{}
+	result := ss.db.WithContext(ctx).Where("name = ?", name).Limit(1).Find(job)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch scheduler job: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (ss *SchedulerService) jobStatus(def models.SchedulerJob) SchedulerJobStatus {
+	status := SchedulerJobStatus{SchedulerJob: def}
+
+	ss.mu.Lock()
+	job, ok := ss.jobs[def.Name]
+	ss.mu.Unlock()
+
+	if ok && job.entryID != 0 {
+		entry := ss.cron.Entry(job.entryID)
+		status.Scheduled = entry.Valid()
+		if !entry.Next.IsZero() {
+			next := entry.Next
+			status.NextRun = &next
+		}
+		if !entry.Prev.IsZero() {
+			prev := entry.Prev
+			status.LastRun = &prev
+		}
+	}
+
+	return status
+}
+
+func (ss *SchedulerService) jobNamesSorted() []string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	names := make([]string, 0, len(ss.jobs))
+	for name := range ss.jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// seedDefaultJobs creates the built-in jobs that have never been persisted,
+// in one statement that skips names already taken, so replicas starting
+// together do not collide. Deleted jobs keep their row and are not seeded
+// again.
+func (ss *SchedulerService) seedDefaultJobs() error {
+	jobs := make([]models.SchedulerJob, len(defaultSchedulerJobs))
+	copy(jobs, defaultSchedulerJobs)
+
+	result := ss.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoNothing: true,
+	}).Create(&jobs)
+	if result.Error != nil {
+		return fmt.Errorf("failed to seed scheduler jobs: %w", result.Error)
+	}
+
+	if result.RowsAffected > 0 {
+		ss.logger.Info("Seeded default scheduler jobs", "count", result.RowsAffected)
+	}
+	return nil
+}
+
+// syncJobs reconciles cron entries with the job definitions in the database
+func (ss *SchedulerService) syncJobs() error {
+	var defs []models.SchedulerJob
+	if err := ss.db.Find(&defs).Error; err != nil {
+		return fmt.Errorf("failed to load scheduler jobs: %w", err)
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	seen := make(map[string]bool, len(defs))
+	for _, def := range defs {
+		seen[def.Name] = true
+
+		current, ok := ss.jobs[def.Name]
+		if ok && current.def.UpdatedAt.Equal(def.UpdatedAt) {
+			continue
+		}
+		if ok && current.entryID != 0 {
+			ss.cron.Remove(current.entryID)
+		}
+
+		job := &scheduledJob{def: def}
+		if def.Enabled {
+			entryID, err := ss.scheduleJob(def)
+			if err != nil {
+				ss.logger.Error("Failed to schedule job", "job", def.Name, "error", err)
+			} else {
+				job.entryID = entryID
+			}
+		}
+		ss.jobs[def.Name] = job
+	}
+
+	for name, job := range ss.jobs {
+		if seen[name] {
+			continue
+		}
+		if job.entryID != 0 {
+			ss.cron.Remove(job.entryID)
+		}
+		delete(ss.jobs, name)
+	}
+
+	return nil
+}
+
+func (ss *SchedulerService) scheduleJob(def models.SchedulerJob) (cron.EntryID, error) {
+	run, ok := ss.jobTypes[def.JobType]
+	if !ok {
+		return 0, fmt.Errorf("unknown job type %q", def.JobType)
+	}
+
+	lease, err := jobLease(def.Spec)
+	if err != nil {
+		return 0, err
+	}
+
+	params := def.Parameters
+	return ss.cron.AddFunc(def.Spec, ss.exclusive(def, lease, func(ctx context.Context) (int, error) {
+		return run(ctx, params)
+	}))
+}
+
+// syncLoop periodically picks up job changes made through other replicas
+func (ss *SchedulerService) syncLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(jobSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := ss.syncJobs(); err != nil {
+				ss.logger.Error("Failed to sync scheduler jobs", "error", err)
+			}
+		}
+	}
+}
+
+// intParam reads an integer job parameter; JSON numbers decode as float64
+func intParam(params models.JSONMap, key string, defaultValue int) int {
+	switch v := params[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return defaultValue
+	}
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation (23505)
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
\ No newline at end of file
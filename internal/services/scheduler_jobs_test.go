@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"marketplace-app/internal/models"
+)
+
+func TestSeedDefaultJobsSkipsExistingNames(t *testing.T) {
+	db, mock := newTestDB(t)
+	ss := NewSchedulerService(db, nil, nil, nil, testLogger)
+
+	// Every default is offered in one insert, and names already taken by a
+	// job, or by a deleted one, are left alone
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO "scheduler_jobs" .* ON CONFLICT \("name"\) DO NOTHING`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	if err := ss.seedDefaultJobs(); err != nil {
+		t.Fatalf("seedDefaultJobs: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreateJobExists(t *testing.T) {
+	db, mock := newTestDB(t)
+	ss := NewSchedulerService(db, nil, nil, nil, testLogger)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "scheduler_jobs" WHERE name = \$1 AND deleted_at IS NOT NULL`).
+		WithArgs("nightly").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO "scheduler_jobs"`).
+		WillReturnError(&pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"})
+	mock.ExpectRollback()
+
+	job := &models.SchedulerJob{Name: "nightly", Spec: "0 0 3 * * *", JobType: JobTypeHealthCheck, Enabled: true}
+	if err := ss.CreateJob(context.Background(), job); !errors.Is(err, ErrJobExists) {
+		t.Fatalf("got %v, want ErrJobExists", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
\ No newline at end of file
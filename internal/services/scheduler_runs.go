@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"marketplace-app/internal/metrics"
+	"marketplace-app/internal/models"
+)
+
+// Job run outcomes
+const (
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+	JobRunSkipped   = "skipped"
+)
+
+// Job run triggers
+const (
+	JobTriggerScheduled = "scheduled"
+	JobTriggerManual    = "manual"
+)
+
+// defaultRunRetentionDays is how long job run history is kept
+const defaultRunRetentionDays = 14
+
+// defaultStaleCycles is how many intervals a job may go without succeeding
+// before it is reported as stale
+const defaultStaleCycles = 3
+
+// JobRunFilter narrows the job run history returned by ListRuns
+type JobRunFilter struct {
+	JobName    string
+	Status     string
+	Trigger    string
+	InstanceID string
+	Since      *time.Time
+	Until      *time.Time
+	Page       int
+	Limit      int
+}
+
+// JobHealth summarizes recent runs of a job and flags problems
+type JobHealth struct {
+	Name                string     `json:"name"`
+	JobType             string     `json:"job_type"`
+	IntervalSeconds     int64      `json:"interval_seconds"`
+	LastRunAt           *time.Time `json:"last_run_at,omitempty"`
+	LastStatus          string     `json:"last_status,omitempty"`
+	LastDurationMs      int64      `json:"last_duration_ms"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Overran             bool       `json:"overran"`
+	Stale               bool       `json:"stale"`
+	Healthy             bool       `json:"healthy"`
+}
+
+// ListRuns returns job run history, newest first, with the total match count
+func (ss *SchedulerService) ListRuns(ctx context.Context, filter JobRunFilter) ([]models.SchedulerJobRun, int64, error) {
+	query := ss.db.WithContext(ctx).Model(&models.SchedulerJobRun{})
+	if filter.JobName != "" {
+		query = query.Where("job_name = ?", filter.JobName)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Trigger != "" {
+		query = query.Where("trigger = ?", filter.Trigger)
+	}
+	if filter.InstanceID != "" {
+		query = query.Where("instance_id = ?", filter.InstanceID)
+	}
+	if filter.Since != nil {
+		query = query.Where("started_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("started_at <= ?", *filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count job runs: %w", err)
+	}
+
+	var runs []models.SchedulerJobRun
+	err := query.Order("started_at DESC").
+		Offset((filter.Page - 1) * filter.Limit).
+		Limit(filter.Limit).
+		Find(&runs).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch job runs: %w", err)
+	}
+
+	return runs, total, nil
+}
+
+// GetJobHealth evaluates every enabled job's recent runs. A job has overran
+// if its last run took longer than its interval (or was skipped because the
+// previous run was still going), and is stale if it has not succeeded within
+// the given number of cycles.
+func (ss *SchedulerService) GetJobHealth(ctx context.Context, cycles int) ([]JobHealth, error) {
+	var defs []models.SchedulerJob
+	if err := ss.db.WithContext(ctx).Where("enabled = ?", true).Order("name").Find(&defs).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch scheduler jobs: %w", err)
+	}
+
+	results := make([]JobHealth, 0, len(defs))
+	for _, def := range defs {
+		health, err := ss.jobHealth(ctx, def, cycles)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, health)
+	}
+
+	return results, nil
+}
+
+// CleanupJobRuns deletes job run history older than the given number of days
+func (ss *SchedulerService) CleanupJobRuns(ctx context.Context, olderThanDays int) (int64, error) {
+	cutoffDate := time.Now().AddDate(0, 0, -olderThanDays)
+
+	result := ss.db.WithContext(ctx).Where("started_at < ?", cutoffDate).Delete(&models.SchedulerJobRun{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to cleanup job runs: %w", result.Error)
+	}
+
+	ss.logger.InfoContext(ctx, "Cleaned up scheduler job runs", "count", result.RowsAffected)
+	return result.RowsAffected, nil
+}
+
+// Private helper methods
+
+func (ss *SchedulerService) recordRun(run *models.SchedulerJobRun, status string, items int, err error) {
+	run.FinishedAt = time.Now()
+	run.DurationMs = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	run.Status = status
+	run.ItemsProcessed = items
+	if err != nil {
+		run.ErrorMessage = err.Error()
+	}
+
+	metrics.SchedulerJobDuration.WithLabelValues(run.JobName, status).
+		Observe(run.FinishedAt.Sub(run.StartedAt).Seconds())
+
+	if err := ss.db.Create(run).Error; err != nil {
+		ss.logger.Error("Failed to record job run", "job", run.JobName, "error", err)
+	}
+}
+
+func (ss *SchedulerService) jobHealth(ctx context.Context, def models.SchedulerJob, cycles int) (JobHealth, error) {
+	health := JobHealth{Name: def.Name, JobType: def.JobType}
+
+	interval, err := scheduleInterval(def.Spec)
+	if err != nil {
+		return health, fmt.Errorf("invalid spec for job %s: %w", def.Name, err)
+	}
+	health.IntervalSeconds = int64(interval.Seconds())
+
+	var recent []models.SchedulerJobRun
+	err = ss.db.WithContext(ctx).Where("job_name = ?", def.Name).
+		Order("started_at DESC").
+		Limit(cycles + 1).
+		Find(&recent).Error
+	if err != nil {
+		return health, fmt.Errorf("failed to fetch runs for job %s: %w", def.Name, err)
+	}
+
+	for i, run := range recent {
+		if i == 0 {
+			startedAt := run.StartedAt
+			health.LastRunAt = &startedAt
+			health.LastStatus = run.Status
+			health.LastDurationMs = run.DurationMs
+			health.Overran = run.Status == JobRunSkipped ||
+				time.Duration(run.DurationMs)*time.Millisecond > interval
+		}
+		if run.Status != JobRunFailed {
+			break
+		}
+		health.ConsecutiveFailures++
+	}
+
+	var lastSuccess models.SchedulerJobRun
+	result := ss.db.WithContext(ctx).Where("job_name = ? AND status = ?", def.Name, JobRunSucceeded).
+		Order("started_at DESC").
+		Limit(1).
+		Find(&lastSuccess)
+	if result.Error != nil {
+		return health, fmt.Errorf("failed to fetch last success for job %s: %w", def.Name, result.Error)
+	}
+
+	// Measure staleness from the last success, or from when the job was
+	// last changed if it has not succeeded since
+	since := def.UpdatedAt
+	if result.RowsAffected > 0 {
+		startedAt := lastSuccess.StartedAt
+		health.LastSuccessAt = &startedAt
+		if startedAt.After(since) {
+			since = startedAt
+		}
+	}
+	health.Stale = time.Since(since) > time.Duration(cycles)*interval
+
+	health.Healthy = !health.Overran && !health.Stale
+	return health, nil
+}
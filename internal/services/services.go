@@ -1,6 +1,10 @@
 package services
 
 import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+
 	"gorm.io/gorm"
 	"marketplace-app/internal/config"
 )
@@ -12,34 +16,71 @@ type Services struct {
 	Token     *TokenService
 	Cache     *CacheService
 	Scheduler *SchedulerService
+	Locks     *LockService
+	Alerts    *AlertService
+	Upstream  *UpstreamClient
+	Health    *HealthService
+	RateLimit *RateLimiter
+	// RateLimitPlans resolves per-tenant limits; nil without a database
+	RateLimitPlans *RateLimitPlanService
+	Logger         *slog.Logger
+
+	// draining is set once shutdown begins so readiness checks fail
+	draining atomic.Bool
 }
 
-// NewServices creates and initializes all services
-func NewServices(db *gorm.DB, cfg *config.Config) *Services {
+// NewServices creates and initializes all services. Each service logs
+// through logger, tagged with its component name.
+func NewServices(db *gorm.DB, cfg *config.Config, logger *slog.Logger) *Services {
 	// Initialize cache service
-	cacheService := NewCacheService(cfg)
+	cacheService := NewCacheService(cfg, logger.With("component", "cache"))
+
+	// Initialize alerting for token expiry and health notifications
+	alertService := NewAlertService(cfg, cacheService, logger.With("component", "alerts"))
+
+	// Initialize distributed locks so scheduled jobs and token refreshes
+	// run on a single replica
+	lockService := NewLockService(cacheService, db, cfg.InstanceID, logger.With("component", "locks"))
+
+	// Initialize per-provider token refresh and validity policies
+	tokenPolicies := NewTokenPolicies(cfg, logger.With("component", "token_policy"))
+
+	// Initialize the shared client for provider APIs
+	upstreamClient := NewUpstreamClient(cfg, logger.With("component", "upstream"))
 
 	// Initialize core services
-	nangoService := NewNangoService(db, cfg)
-	businessService := NewBusinessService(db, nangoService, cacheService)
-	tokenService := NewTokenService(db, nangoService)
+	nangoService := NewNangoService(db, cfg, upstreamClient, tokenPolicies, lockService, logger.With("component", "nango"))
+	businessService := NewBusinessService(db, cfg, nangoService, cacheService, logger.With("component", "business"))
+	tokenService := NewTokenService(db, nangoService, alertService, tokenPolicies, logger.With("component", "token"))
+
+	// Initialize rate limiting with per-tenant plans
+	rateLimiter := NewRateLimiter(cfg, cacheService, logger.With("component", "rate_limit"))
+	rateLimitPlans := NewRateLimitPlanService(db, cacheService, rateLimiter, logger.With("component", "rate_limit_plans"))
 
 	// Initialize scheduler service
-	schedulerService := NewSchedulerService(tokenService)
+	schedulerService := NewSchedulerService(db, tokenService, lockService, alertService, logger.With("component", "scheduler"))
 
 	return &Services{
-		Nango:     nangoService,
-		Business:  businessService,
-		Token:     tokenService,
-		Cache:     cacheService,
-		Scheduler: schedulerService,
+		Nango:          nangoService,
+		Business:       businessService,
+		Token:          tokenService,
+		Cache:          cacheService,
+		Scheduler:      schedulerService,
+		Locks:          lockService,
+		Alerts:         alertService,
+		Upstream:       upstreamClient,
+		Health:         NewHealthService(db, cacheService, upstreamClient, cfg),
+		RateLimit:      rateLimiter,
+		RateLimitPlans: rateLimitPlans,
+		Logger:         logger,
 	}
 }
 
 // NewServicesWithoutDB creates services without database dependency (for testing)
 func NewServicesWithoutDB(cfg *config.Config) *Services {
 	// Initialize only cache service for OAuth URL generation
-	cacheService := NewCacheService(cfg)
+	cacheService := NewCacheService(cfg, slog.Default())
+	upstreamClient := NewUpstreamClient(cfg, slog.Default())
 
 	return &Services{
 		Nango:     nil,
@@ -47,6 +88,10 @@ func NewServicesWithoutDB(cfg *config.Config) *Services {
 		Token:     nil,
 		Cache:     cacheService,
 		Scheduler: nil,
+		Upstream:  upstreamClient,
+		Health:    NewHealthService(nil, cacheService, upstreamClient, cfg),
+		RateLimit: NewRateLimiter(cfg, cacheService, slog.Default()),
+		Logger:    slog.Default(),
 	}
 }
 
@@ -56,12 +101,35 @@ func (s *Services) Start() error {
 	return s.Scheduler.Start()
 }
 
-// Stop gracefully shuts down all services
-func (s *Services) Stop() {
+// BeginDrain marks the instance as shutting down so readiness checks fail
+// and load balancers stop routing new requests to it
+func (s *Services) BeginDrain() {
+	s.draining.Store(true)
+}
+
+// Draining reports whether shutdown has begun
+func (s *Services) Draining() bool {
+	return s.draining.Load()
+}
+
+// Shutdown stops background work in dependency order: the scheduler and sync
+// workers first, then the alert outbox is flushed and the cache closed. Work
+// still running when ctx ends is cancelled.
+func (s *Services) Shutdown(ctx context.Context) {
+	s.Logger.InfoContext(ctx, "Shutting down services")
+
 	if s.Scheduler != nil {
-		s.Scheduler.Stop()
+		s.Scheduler.Stop(ctx)
+	}
+	if s.Business != nil {
+		s.Business.Stop(ctx)
+	}
+	if s.Alerts != nil {
+		s.Alerts.Close(ctx)
 	}
 	if s.Cache != nil {
 		s.Cache.Close()
 	}
+
+	s.Logger.InfoContext(ctx, "Services shut down")
 }
\ No newline at end of file
@@ -1,8 +1,9 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"gorm.io/gorm"
@@ -10,117 +11,125 @@ import (
 )
 
 type TokenService struct {
-	db    *gorm.DB
-	nango *NangoService
+	db       *gorm.DB
+	nango    *NangoService
+	alerts   *AlertService
+	policies *TokenPolicies
+	logger   *slog.Logger
 }
 
-func NewTokenService(db *gorm.DB, nango *NangoService) *TokenService {
+func NewTokenService(db *gorm.DB, nango *NangoService, alerts *AlertService, policies *TokenPolicies, logger *slog.Logger) *TokenService {
 	return &TokenService{
-		db:    db,
-		nango: nango,
+		db:       db,
+		nango:    nango,
+		alerts:   alerts,
+		policies: policies,
+		logger:   logger,
 	}
 }
 
-// RefreshExpiredTokens finds and refreshes tokens that are about to expire
-func (ts *TokenService) RefreshExpiredTokens() error {
-	log.Println("Starting token refresh job...")
+// RefreshExpiredTokens finds and refreshes tokens that are about to expire.
+// It returns the number of tokens it attempted to refresh.
+func (ts *TokenService) RefreshExpiredTokens(ctx context.Context) (int, error) {
+	ts.logger.InfoContext(ctx, "Starting token refresh job")
 
-	// Find tokens that need refreshing (within 24 hours of expiry)
+	// Find tokens whose policy-scheduled refresh time has passed
 	var tokenRefreshes []models.TokenRefresh
-	err := ts.db.Where("next_refresh <= ? AND status = ?", time.Now(), "active").
+	err := ts.db.WithContext(ctx).Where("next_refresh <= ? AND status = ?", time.Now(), "active").
 		Preload("Company").
 		Find(&tokenRefreshes).Error
 
 	if err != nil {
-		return fmt.Errorf("failed to fetch tokens for refresh: %w", err)
+		return 0, fmt.Errorf("failed to fetch tokens for refresh: %w", err)
 	}
 
-	log.Printf("Found %d tokens to refresh", len(tokenRefreshes))
+	ts.logger.InfoContext(ctx, "Found tokens to refresh", "count", len(tokenRefreshes))
 
 	successCount := 0
 	failureCount := 0
 
 	for _, tokenRefresh := range tokenRefreshes {
-		if err := ts.refreshSingleToken(&tokenRefresh); err != nil {
-			log.Printf("Failed to refresh token for company %s: %v", 
-				tokenRefresh.Company.CompanyID, err)
+		if err := ts.refreshSingleToken(ctx, &tokenRefresh); err != nil {
+			ts.logger.ErrorContext(ctx, "Failed to refresh token",
+				"company_id", tokenRefresh.Company.CompanyID, "error", err)
 			failureCount++
 			
 			// Update token refresh record with error
 			tokenRefresh.Status = "failed"
 			tokenRefresh.ErrorMessage = err.Error()
-			ts.db.Save(&tokenRefresh)
+			ts.db.WithContext(ctx).Save(&tokenRefresh)
 		} else {
-			log.Printf("Successfully refreshed token for company %s", 
-				tokenRefresh.Company.CompanyID)
+			ts.logger.InfoContext(ctx, "Refreshed token", "company_id", tokenRefresh.Company.CompanyID)
+			ts.resolveExpiryAlert(ctx, tokenRefresh.Company.CompanyID)
 			successCount++
 		}
 	}
 
-	log.Printf("Token refresh job completed. Success: %d, Failures: %d", 
-		successCount, failureCount)
+	ts.logger.InfoContext(ctx, "Token refresh job completed",
+		"succeeded", successCount, "failed", failureCount)
 
-	return nil
+	return len(tokenRefreshes), nil
 }
 
 // RefreshTokenForCompany manually refreshes token for a specific company
-func (ts *TokenService) RefreshTokenForCompany(companyID string) error {
+func (ts *TokenService) RefreshTokenForCompany(ctx context.Context, companyID string) error {
 	company := &models.Company{}
-	err := ts.db.Where("company_id = ?", companyID).First(company).Error
+	err := ts.db.WithContext(ctx).Where("company_id = ?", companyID).First(company).Error
 	if err != nil {
 		return fmt.Errorf("company not found: %w", err)
 	}
 
 	// Check if token actually needs refreshing
-	if time.Until(company.TokenExpiry) > 24*time.Hour {
+	if !ts.policies.ForCompany(company).NeedsRefresh(tokenIssuedAt(company), company.TokenExpiry) {
 		return fmt.Errorf("token for company %s does not need refreshing yet", companyID)
 	}
 
-	return ts.nango.RefreshToken(companyID)
+	if _, err := ts.nango.RefreshToken(ctx, companyID); err != nil {
+		return err
+	}
+
+	ts.resolveExpiryAlert(ctx, companyID)
+	return nil
 }
 
 // ValidateToken checks if a token is still valid
-func (ts *TokenService) ValidateToken(companyID string) (bool, error) {
+func (ts *TokenService) ValidateToken(ctx context.Context, companyID string) (bool, error) {
 	company := &models.Company{}
-	err := ts.db.Where("company_id = ? AND is_active = ?", companyID, true).First(company).Error
+	err := ts.db.WithContext(ctx).Where("company_id = ? AND is_active = ?", companyID, true).First(company).Error
 	if err != nil {
 		return false, fmt.Errorf("company not found: %w", err)
 	}
 
-	// Check if token is expired
-	if time.Now().After(company.TokenExpiry) {
-		return false, nil
-	}
-
-	// Check if token expires within the next hour (consider it invalid for safety)
-	if time.Until(company.TokenExpiry) < time.Hour {
-		return false, nil
-	}
-
-	return true, nil
+	// Tokens inside the provider's validity margin are treated as invalid for safety
+	return ts.policies.ForCompany(company).IsValid(tokenIssuedAt(company), company.TokenExpiry), nil
 }
 
 // GetTokenExpiryInfo returns token expiry information for a company
-func (ts *TokenService) GetTokenExpiryInfo(companyID string) (*TokenExpiryInfo, error) {
+func (ts *TokenService) GetTokenExpiryInfo(ctx context.Context, companyID string) (*TokenExpiryInfo, error) {
 	company := &models.Company{}
-	err := ts.db.Where("company_id = ?", companyID).First(company).Error
+	err := ts.db.WithContext(ctx).Where("company_id = ?", companyID).First(company).Error
 	if err != nil {
 		return nil, fmt.Errorf("company not found: %w", err)
 	}
 
 	tokenRefresh := &models.TokenRefresh{}
-	err = ts.db.Where("company_id = ?", company.ID).First(tokenRefresh).Error
+	err = ts.db.WithContext(ctx).Where("company_id = ?", company.ID).First(tokenRefresh).Error
 	if err != nil {
 		return nil, fmt.Errorf("token refresh record not found: %w", err)
 	}
 
+	policy := ts.policies.ForCompany(company)
+	issuedAt := tokenIssuedAt(company)
+
 	return &TokenExpiryInfo{
 		CompanyID:    companyID,
 		CompanyName:  company.CompanyName,
+		Provider:     company.Provider,
 		TokenExpiry:  company.TokenExpiry,
 		TimeToExpiry: time.Until(company.TokenExpiry),
 		IsExpired:    time.Now().After(company.TokenExpiry),
-		NeedsRefresh: time.Until(company.TokenExpiry) < 24*time.Hour,
+		NeedsRefresh: policy.NeedsRefresh(issuedAt, company.TokenExpiry),
+		Severity:     policy.Severity(issuedAt, company.TokenExpiry),
 		LastRefresh:  tokenRefresh.LastRefresh,
 		NextRefresh:  tokenRefresh.NextRefresh,
 		RefreshCount: tokenRefresh.RefreshCount,
@@ -129,19 +138,19 @@ func (ts *TokenService) GetTokenExpiryInfo(companyID string) (*TokenExpiryInfo,
 }
 
 // GetAllTokenStatuses returns token status for all companies
-func (ts *TokenService) GetAllTokenStatuses() ([]TokenExpiryInfo, error) {
+func (ts *TokenService) GetAllTokenStatuses(ctx context.Context) ([]TokenExpiryInfo, error) {
 	var companies []models.Company
-	err := ts.db.Where("is_active = ?", true).Find(&companies).Error
+	err := ts.db.WithContext(ctx).Where("is_active = ?", true).Find(&companies).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch companies: %w", err)
 	}
 
 	var statuses []TokenExpiryInfo
 	for _, company := range companies {
-		info, err := ts.GetTokenExpiryInfo(company.CompanyID)
+		info, err := ts.GetTokenExpiryInfo(ctx, company.CompanyID)
 		if err != nil {
-			log.Printf("Failed to get token info for company %s: %v", 
-				company.CompanyID, err)
+			ts.logger.WarnContext(ctx, "Failed to get token info",
+				"company_id", company.CompanyID, "error", err)
 			continue
 		}
 		statuses = append(statuses, *info)
@@ -151,52 +160,59 @@ func (ts *TokenService) GetAllTokenStatuses() ([]TokenExpiryInfo, error) {
 }
 
 // MarkTokenAsExpired marks a token as expired (for manual intervention)
-func (ts *TokenService) MarkTokenAsExpired(companyID string) error {
+func (ts *TokenService) MarkTokenAsExpired(ctx context.Context, companyID string) error {
 	company := &models.Company{}
-	err := ts.db.Where("company_id = ?", companyID).First(company).Error
+	err := ts.db.WithContext(ctx).Where("company_id = ?", companyID).First(company).Error
 	if err != nil {
 		return fmt.Errorf("company not found: %w", err)
 	}
 
 	// Update company status
 	company.IsActive = false
-	if err := ts.db.Save(company).Error; err != nil {
+	if err := ts.db.WithContext(ctx).Save(company).Error; err != nil {
 		return fmt.Errorf("failed to update company: %w", err)
 	}
 
 	// Update token refresh record
 	tokenRefresh := &models.TokenRefresh{}
-	err = ts.db.Where("company_id = ?", company.ID).First(tokenRefresh).Error
+	err = ts.db.WithContext(ctx).Where("company_id = ?", company.ID).First(tokenRefresh).Error
 	if err == nil {
 		tokenRefresh.Status = "expired"
 		tokenRefresh.ErrorMessage = "Manually marked as expired"
-		ts.db.Save(tokenRefresh)
+		ts.db.WithContext(ctx).Save(tokenRefresh)
 	}
 
 	return nil
 }
 
-// CleanupExpiredTokens removes old expired token records
-func (ts *TokenService) CleanupExpiredTokens() error {
-	// Delete token refresh records older than 30 days with failed/expired status
-	cutoffDate := time.Now().AddDate(0, 0, -30)
+// CleanupExpiredTokens removes expired token records older than the given
+// number of days and returns how many were deleted
+func (ts *TokenService) CleanupExpiredTokens(ctx context.Context, olderThanDays int) (int64, error) {
+	// Delete old token refresh records with failed/expired status
+	cutoffDate := time.Now().AddDate(0, 0, -olderThanDays)
 
-	result := ts.db.Where("updated_at < ? AND status IN ?", 
+	result := ts.db.WithContext(ctx).Where("updated_at < ? AND status IN ?", 
 		cutoffDate, []string{"failed", "expired"}).Delete(&models.TokenRefresh{})
 
 	if result.Error != nil {
-		return fmt.Errorf("failed to cleanup expired tokens: %w", result.Error)
+		return 0, fmt.Errorf("failed to cleanup expired tokens: %w", result.Error)
 	}
 
-	log.Printf("Cleaned up %d expired token records", result.RowsAffected)
-	return nil
+	ts.logger.InfoContext(ctx, "Cleaned up expired token records", "count", result.RowsAffected)
+	return result.RowsAffected, nil
 }
 
 // Private helper methods
 
-func (ts *TokenService) refreshSingleToken(tokenRefresh *models.TokenRefresh) error {
+// resolveExpiryAlert clears any expiry alert raised for a company's token
+func (ts *TokenService) resolveExpiryAlert(ctx context.Context, companyID string) {
+	ts.alerts.Resolve(ctx, TokenExpiryAlertKey(companyID), tokenExpiryAlertTitle,
+		fmt.Sprintf("Token for company %s was refreshed", companyID))
+}
+
+func (ts *TokenService) refreshSingleToken(ctx context.Context, tokenRefresh *models.TokenRefresh) error {
 	// Attempt to refresh the token
-	err := ts.nango.RefreshToken(tokenRefresh.Company.CompanyID)
+	updatedCompany, err := ts.nango.RefreshToken(ctx, tokenRefresh.Company.CompanyID)
 	if err != nil {
 		return fmt.Errorf("nango refresh failed: %w", err)
 	}
@@ -207,27 +223,23 @@ func (ts *TokenService) refreshSingleToken(tokenRefresh *models.TokenRefresh) er
 	tokenRefresh.Status = "active"
 	tokenRefresh.ErrorMessage = ""
 
-	// Get updated company to set next refresh time
-	updatedCompany := &models.Company{}
-	err = ts.db.Where("id = ?", tokenRefresh.CompanyID).First(updatedCompany).Error
-	if err != nil {
-		return fmt.Errorf("failed to get updated company: %w", err)
-	}
-
-	// Set next refresh to 24 hours before expiry
-	tokenRefresh.NextRefresh = updatedCompany.TokenExpiry.Add(-24 * time.Hour)
+	// Schedule the next refresh per the provider's policy
+	tokenRefresh.NextRefresh = ts.policies.ForCompany(updatedCompany).NextRefresh(
+		tokenIssuedAt(updatedCompany), updatedCompany.TokenExpiry)
 
-	return ts.db.Save(tokenRefresh).Error
+	return ts.db.WithContext(ctx).Save(tokenRefresh).Error
 }
 
 // TokenExpiryInfo holds information about token expiry status
 type TokenExpiryInfo struct {
 	CompanyID    string        `json:"company_id"`
 	CompanyName  string        `json:"company_name"`
+	Provider     string        `json:"provider"`
 	TokenExpiry  time.Time     `json:"token_expiry"`
 	TimeToExpiry time.Duration `json:"time_to_expiry"`
 	IsExpired    bool          `json:"is_expired"`
 	NeedsRefresh bool          `json:"needs_refresh"`
+	Severity     string        `json:"severity,omitempty"` // alert severity per the token policy
 	LastRefresh  time.Time     `json:"last_refresh"`
 	NextRefresh  time.Time     `json:"next_refresh"`
 	RefreshCount int           `json:"refresh_count"`
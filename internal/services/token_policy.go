@@ -0,0 +1,184 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"marketplace-app/internal/config"
+	"marketplace-app/internal/models"
+)
+
+// ProviderGoHighLevel identifies tokens issued by GoHighLevel
+const ProviderGoHighLevel = "gohighlevel"
+
+// PolicyDuration is a span of time given either as an absolute duration or
+// as a fraction of the token's total lifetime
+type PolicyDuration struct {
+	Absolute time.Duration
+	Fraction float64
+}
+
+// Of resolves the duration for a token with the given lifetime
+func (d PolicyDuration) Of(lifetime time.Duration) time.Duration {
+	if d.Fraction > 0 {
+		return time.Duration(float64(lifetime) * d.Fraction)
+	}
+	return d.Absolute
+}
+
+// String formats the duration the same way ParsePolicyDuration accepts it
+func (d PolicyDuration) String() string {
+	if d.Fraction > 0 {
+		return strconv.FormatFloat(d.Fraction*100, 'f', -1, 64) + "%"
+	}
+	return d.Absolute.String()
+}
+
+// ParsePolicyDuration parses "24h"-style durations or "25%" lifetime fractions
+func ParsePolicyDuration(value string) (PolicyDuration, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return PolicyDuration{}, fmt.Errorf("invalid lifetime percentage %q", value)
+		}
+		return PolicyDuration{Fraction: percent / 100}, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return PolicyDuration{}, fmt.Errorf("invalid duration %q: %w", value, err)
+	}
+	return PolicyDuration{Absolute: duration}, nil
+}
+
+// TokenPolicy decides when a provider's tokens are refreshed, considered
+// valid, and alerted on. All spans are measured back from token expiry.
+type TokenPolicy struct {
+	// RefreshLead is how long before expiry a token is refreshed
+	RefreshLead PolicyDuration
+	// ValidityMargin is how close to expiry a token stops being treated as valid
+	ValidityMargin PolicyDuration
+	// WarningThreshold is the remaining lifetime below which a warning is raised
+	WarningThreshold PolicyDuration
+	// CriticalThreshold is the remaining lifetime below which a critical alert is raised
+	CriticalThreshold PolicyDuration
+}
+
+// NextRefresh returns when a token issued at issuedAt should next be refreshed
+func (p TokenPolicy) NextRefresh(issuedAt, expiresAt time.Time) time.Time {
+	return expiresAt.Add(-p.RefreshLead.Of(expiresAt.Sub(issuedAt)))
+}
+
+// NeedsRefresh reports whether the token is within its refresh lead time
+func (p TokenPolicy) NeedsRefresh(issuedAt, expiresAt time.Time) bool {
+	return !time.Now().Before(p.NextRefresh(issuedAt, expiresAt))
+}
+
+// IsValid reports whether the token can still safely be used
+func (p TokenPolicy) IsValid(issuedAt, expiresAt time.Time) bool {
+	return time.Until(expiresAt) >= p.ValidityMargin.Of(expiresAt.Sub(issuedAt))
+}
+
+// Severity returns the alert severity for the token's remaining lifetime,
+// or an empty string if no alert is warranted
+func (p TokenPolicy) Severity(issuedAt, expiresAt time.Time) string {
+	lifetime := expiresAt.Sub(issuedAt)
+	remaining := time.Until(expiresAt)
+
+	switch {
+	case remaining <= 0 || remaining < p.CriticalThreshold.Of(lifetime):
+		return AlertSeverityCritical
+	case remaining < p.WarningThreshold.Of(lifetime):
+		return AlertSeverityWarning
+	default:
+		return ""
+	}
+}
+
+// defaultTokenPolicy applies to providers without a policy of their own
+var defaultTokenPolicy = TokenPolicy{
+	RefreshLead:       PolicyDuration{Absolute: 24 * time.Hour},
+	ValidityMargin:    PolicyDuration{Absolute: time.Hour},
+	WarningThreshold:  PolicyDuration{Absolute: 48 * time.Hour},
+	CriticalThreshold: PolicyDuration{Absolute: 24 * time.Hour},
+}
+
+// TokenPolicies holds the token policy for each provider
+type TokenPolicies struct {
+	defaultPolicy TokenPolicy
+	byProvider    map[string]TokenPolicy
+}
+
+// NewTokenPolicies builds policies from configuration. Invalid settings are
+// logged and replaced by the built-in default for that setting.
+func NewTokenPolicies(cfg *config.Config, logger *slog.Logger) *TokenPolicies {
+	tp := &TokenPolicies{
+		defaultPolicy: defaultTokenPolicy,
+		byProvider:    make(map[string]TokenPolicy),
+	}
+
+	for provider, settings := range cfg.TokenPolicies {
+		policy := policyFromConfig(provider, settings, logger)
+		if provider == config.DefaultTokenPolicy {
+			tp.defaultPolicy = policy
+			continue
+		}
+		tp.byProvider[provider] = policy
+	}
+
+	return tp
+}
+
+// For returns the policy for a provider
+func (tp *TokenPolicies) For(provider string) TokenPolicy {
+	if policy, ok := tp.byProvider[provider]; ok {
+		return policy
+	}
+	return tp.defaultPolicy
+}
+
+// ForCompany returns the policy for the provider that issued a company's token
+func (tp *TokenPolicies) ForCompany(company *models.Company) TokenPolicy {
+	return tp.For(company.Provider)
+}
+
+// tokenIssuedAt returns when a company's current token was issued. Rows
+// created before issue times were recorded fall back to the last update.
+func tokenIssuedAt(company *models.Company) time.Time {
+	if !company.TokenIssuedAt.IsZero() {
+		return company.TokenIssuedAt
+	}
+	return company.UpdatedAt
+}
+
+func policyFromConfig(provider string, settings config.TokenPolicyConfig, logger *slog.Logger) TokenPolicy {
+	policy := defaultTokenPolicy
+	fields := []struct {
+		name   string
+		value  string
+		target *PolicyDuration
+	}{
+		{"refresh lead", settings.RefreshLead, &policy.RefreshLead},
+		{"validity margin", settings.ValidityMargin, &policy.ValidityMargin},
+		{"warning threshold", settings.WarningThreshold, &policy.WarningThreshold},
+		{"critical threshold", settings.CriticalThreshold, &policy.CriticalThreshold},
+	}
+
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		parsed, err := ParsePolicyDuration(field.value)
+		if err != nil {
+			logger.Warn("Ignoring invalid token policy setting", "provider", provider, "setting", field.name, "error", err)
+			continue
+		}
+		*field.target = parsed
+	}
+
+	return policy
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"marketplace-app/internal/config"
+	"marketplace-app/internal/models"
+)
+
+func TestParsePolicyDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  PolicyDuration
+		err   bool
+	}{
+		{value: "25%", want: PolicyDuration{Fraction: 0.25}},
+		{value: " 100% ", want: PolicyDuration{Fraction: 1}},
+		{value: "36h", want: PolicyDuration{Absolute: 36 * time.Hour}},
+		{value: "0%", err: true},
+		{value: "150%", err: true},
+		{value: "soon", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePolicyDuration(tt.value)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParsePolicyDuration(%q) = %+v, %v; want %+v, error %v", tt.value, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestTokenPolicyThresholds(t *testing.T) {
+	percent := TokenPolicy{
+		RefreshLead:       PolicyDuration{Fraction: 0.25},
+		ValidityMargin:    PolicyDuration{Absolute: time.Hour},
+		WarningThreshold:  PolicyDuration{Fraction: 0.2},
+		CriticalThreshold: PolicyDuration{Fraction: 0.1},
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		policy      TokenPolicy
+		issuedAgo   time.Duration
+		remaining   time.Duration
+		nextRefresh time.Duration // before expiry
+		severity    string
+		valid       bool
+	}{
+		// A day-long token: refreshed 6h before expiry, warned under 4.8h
+		{"percent healthy", percent, 12 * time.Hour, 12 * time.Hour, 6 * time.Hour, "", true},
+		{"percent warning", percent, 20 * time.Hour, 4 * time.Hour, 6 * time.Hour, AlertSeverityWarning, true},
+		{"percent critical", percent, 22 * time.Hour, 2 * time.Hour, 6 * time.Hour, AlertSeverityCritical, true},
+		// Absolute spans do not depend on the lifetime
+		{"absolute healthy", defaultTokenPolicy, 24 * time.Hour, 72 * time.Hour, 24 * time.Hour, "", true},
+		{"absolute warning", defaultTokenPolicy, 24 * time.Hour, 30 * time.Hour, 24 * time.Hour, AlertSeverityWarning, true},
+		{"absolute critical", defaultTokenPolicy, 24 * time.Hour, 30 * time.Minute, 24 * time.Hour, AlertSeverityCritical, false},
+		{"expired", defaultTokenPolicy, 24 * time.Hour, -time.Minute, 24 * time.Hour, AlertSeverityCritical, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuedAt, expiresAt := now.Add(-tt.issuedAgo), now.Add(tt.remaining)
+
+			if got := tt.policy.NextRefresh(issuedAt, expiresAt); !got.Equal(expiresAt.Add(-tt.nextRefresh)) {
+				t.Errorf("NextRefresh = %v before expiry, want %v", expiresAt.Sub(got), tt.nextRefresh)
+			}
+			if got := tt.policy.Severity(issuedAt, expiresAt); got != tt.severity {
+				t.Errorf("Severity = %q, want %q", got, tt.severity)
+			}
+			if got := tt.policy.IsValid(issuedAt, expiresAt); got != tt.valid {
+				t.Errorf("IsValid = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestTokenIssuedAtFallsBackToUpdate(t *testing.T) {
+	updatedAt := time.Now().Add(-time.Hour)
+	company := &models.Company{UpdatedAt: updatedAt}
+	if got := tokenIssuedAt(company); !got.Equal(updatedAt) {
+		t.Errorf("got %v, want the last update for a token without an issue time", got)
+	}
+
+	company.TokenIssuedAt = updatedAt.Add(-time.Hour)
+	if got := tokenIssuedAt(company); !got.Equal(company.TokenIssuedAt) {
+		t.Errorf("got %v, want the recorded issue time", got)
+	}
+}
+
+func TestTokenPoliciesFromEnvironment(t *testing.T) {
+	t.Setenv("TOKEN_POLICY_PROVIDERS", "acme")
+	t.Setenv("TOKEN_POLICY_DEFAULT_WARNING_THRESHOLD", "36h")
+	t.Setenv("TOKEN_POLICY_GOHIGHLEVEL_REFRESH_LEAD", "40%")
+	t.Setenv("TOKEN_POLICY_GOHIGHLEVEL_VALIDITY_MARGIN", "whenever")
+	t.Setenv("TOKEN_POLICY_ACME_CRITICAL_THRESHOLD", "2h")
+
+	policies := NewTokenPolicies(config.Load(), testLogger)
+
+	tests := []struct {
+		provider string
+		field    string
+		got      PolicyDuration
+		want     PolicyDuration
+	}{
+		{"gohighlevel", "refresh lead", policies.For(ProviderGoHighLevel).RefreshLead, PolicyDuration{Fraction: 0.4}},
+		{"gohighlevel", "built-in percent", policies.For(ProviderGoHighLevel).WarningThreshold, PolicyDuration{Fraction: 0.2}},
+		// Invalid settings keep the built-in default
+		{"gohighlevel", "invalid validity margin", policies.For(ProviderGoHighLevel).ValidityMargin, PolicyDuration{Absolute: time.Hour}},
+		{"acme", "critical threshold", policies.For("acme").CriticalThreshold, PolicyDuration{Absolute: 2 * time.Hour}},
+		{"acme", "unset warning threshold", policies.For("acme").WarningThreshold, PolicyDuration{Absolute: 48 * time.Hour}},
+		// Unknown providers get the default policy, including its overrides
+		{"unknown", "warning threshold", policies.For("unknown").WarningThreshold, PolicyDuration{Absolute: 36 * time.Hour}},
+		{"unknown", "refresh lead", policies.ForCompany(&models.Company{Provider: "unknown"}).RefreshLead, PolicyDuration{Absolute: 24 * time.Hour}},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s %s = %v, want %v", tt.provider, tt.field, tt.got, tt.want)
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,484 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"marketplace-app/internal/config"
+	"marketplace-app/internal/metrics"
+	"marketplace-app/internal/telemetry"
+)
+
+// ErrCircuitOpen is returned without calling a provider whose circuit breaker is open
+var ErrCircuitOpen = errors.New("upstream circuit breaker is open")
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+const (
+	// upstreamBaseBackoff and upstreamMaxBackoff bound the jittered retry delay
+	upstreamBaseBackoff = 200 * time.Millisecond
+	upstreamMaxBackoff  = 10 * time.Second
+	// upstreamMaxRetryAfter is the longest Retry-After that is waited out
+	// in-request; longer delays are returned to the caller instead
+	upstreamMaxRetryAfter = 30 * time.Second
+	// rateLimiterIdleTTL is how long an unused per-resource bucket is kept
+	rateLimiterIdleTTL = 10 * time.Minute
+)
+
+// UpstreamTarget identifies who a request is sent to
+type UpstreamTarget struct {
+	// Provider selects the circuit breaker the request counts against
+	Provider string
+	// Endpoint names the API operation in metrics, e.g. "oauth_token"
+	Endpoint string
+	// Resource is the GoHighLevel location or company the request acts on.
+	// Requests for the same resource share a client-side rate limit; leave
+	// empty for requests that are not rate limited per resource.
+	Resource string
+}
+
+// UpstreamClient is the HTTP client shared by all provider integrations. It
+// retries idempotent requests with jittered backoff, honoring Retry-After,
+// trips a per-provider circuit breaker on repeated failures, and paces
+// requests per GoHighLevel resource with a token bucket.
+type UpstreamClient struct {
+	client           *http.Client
+	maxRetries       int
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	rateBurst        int
+	ratePerSec       float64
+	logger           *slog.Logger
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+	limiters map[string]*tokenBucket
+}
+
+// CircuitBreakerStats describes a provider's circuit breaker
+type CircuitBreakerStats struct {
+	Provider            string     `json:"provider"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+func NewUpstreamClient(cfg *config.Config, logger *slog.Logger) *UpstreamClient {
+	return &UpstreamClient{
+		client: &http.Client{
+			Timeout: cfg.UpstreamTimeout,
+			// Each attempt gets a client span and W3C traceparent headers
+			Transport: otelhttp.NewTransport(http.DefaultTransport,
+				otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+					return "HTTP " + req.Method + " " + req.URL.Host
+				}),
+			),
+		},
+		maxRetries:       cfg.UpstreamMaxRetries,
+		breakerThreshold: cfg.UpstreamBreakerThreshold,
+		breakerCooldown:  cfg.UpstreamBreakerCooldown,
+		rateBurst:        cfg.GoHighLevelRateLimitBurst,
+		ratePerSec:       cfg.GoHighLevelRateLimitPerSec,
+		logger:           logger,
+		breakers:         make(map[string]*circuitBreaker),
+		limiters:         make(map[string]*tokenBucket),
+	}
+}
+
+// Do sends the request. Cancellation and deadlines come from the request's
+// context, which also bounds rate limit and backoff waits. Only idempotent
+// methods are retried: a POST such as a token refresh may have taken effect
+// even when the response was lost.
+func (uc *UpstreamClient) Do(req *http.Request, target UpstreamTarget) (*http.Response, error) {
+	ctx, span := telemetry.Tracer().Start(req.Context(), target.Provider+"."+target.endpoint(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("upstream.provider", target.Provider),
+			attribute.String("upstream.endpoint", target.endpoint()),
+			attribute.String("upstream.resource", target.Resource),
+		),
+	)
+	defer span.End()
+
+	req = req.WithContext(ctx)
+	if requestID := telemetry.RequestID(ctx); requestID != "" && req.Header.Get("X-Request-ID") == "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
+	resp, err := uc.do(req, target)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+		if resp.StatusCode >= 400 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	return resp, err
+}
+
+// BreakerStats returns the state of every provider's circuit breaker
+func (uc *UpstreamClient) BreakerStats() []CircuitBreakerStats {
+	uc.mu.Lock()
+	providers := make([]string, 0, len(uc.breakers))
+	for provider := range uc.breakers {
+		providers = append(providers, provider)
+	}
+	uc.mu.Unlock()
+	sort.Strings(providers)
+
+	stats := make([]CircuitBreakerStats, 0, len(providers))
+	for _, provider := range providers {
+		stats = append(stats, uc.breaker(provider).stats(provider))
+	}
+	return stats
+}
+
+// Private helper methods
+
+func (uc *UpstreamClient) do(req *http.Request, target UpstreamTarget) (*http.Response, error) {
+	ctx := req.Context()
+	breaker := uc.breaker(target.Provider)
+
+	if !breaker.allow() {
+		target.countError("circuit_open")
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, target.Provider)
+	}
+
+	retries := 0
+	if isIdempotent(req.Method) {
+		retries = uc.maxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		// Every attempt, retries included, is paced per resource
+		if target.Resource != "" {
+			if err := uc.limiter(target.Resource).wait(ctx); err != nil {
+				breaker.abandon()
+				return nil, fmt.Errorf("rate limit wait cancelled: %w", err)
+			}
+		}
+
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req.Body = body
+		}
+
+		start := time.Now()
+		resp, err := uc.client.Do(req)
+		target.observe(resp, err, time.Since(start))
+		if ctx.Err() != nil {
+			// The caller gave up, which says nothing about the provider
+			breaker.abandon()
+			return resp, err
+		}
+		breaker.record(target.Provider, resp, err)
+
+		if attempt >= retries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := backoffDelay(attempt)
+		if resp != nil {
+			retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+			if retryAfter > upstreamMaxRetryAfter {
+				return resp, nil
+			}
+			if retryAfter > delay {
+				delay = retryAfter
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxUpstreamErrorBody))
+			resp.Body.Close()
+		}
+
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt+1),
+			attribute.Int64("delay_ms", delay.Milliseconds()),
+		))
+		uc.logger.WarnContext(ctx, "Retrying upstream request", "provider", target.Provider,
+			"method", req.Method, "path", req.URL.Path, "delay", delay.Round(time.Millisecond).String(),
+			"attempt", attempt+1, "max_retries", retries)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if !breaker.allow() {
+			target.countError("circuit_open")
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, target.Provider)
+		}
+	}
+}
+
+func (uc *UpstreamClient) breaker(provider string) *circuitBreaker {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	breaker, ok := uc.breakers[provider]
+	if !ok {
+		breaker = &circuitBreaker{threshold: uc.breakerThreshold, cooldown: uc.breakerCooldown, logger: uc.logger}
+		uc.breakers[provider] = breaker
+	}
+	return breaker
+}
+
+func (uc *UpstreamClient) limiter(resource string) *tokenBucket {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := uc.limiters[resource]
+	if !ok {
+		// Drop idle buckets so the map does not grow with every tenant ever seen
+		for key, idle := range uc.limiters {
+			if idle.idleSince(now) > rateLimiterIdleTTL {
+				delete(uc.limiters, key)
+			}
+		}
+		bucket = newTokenBucket(uc.rateBurst, uc.ratePerSec)
+		uc.limiters[resource] = bucket
+	}
+	return bucket
+}
+
+// observe records the latency of one attempt, counting error responses and
+// network failures
+func (t UpstreamTarget) observe(resp *http.Response, err error, elapsed time.Duration) {
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.UpstreamRequestDuration.WithLabelValues(t.Provider, t.endpoint(), status).Observe(elapsed.Seconds())
+
+	if err != nil {
+		t.countError("network")
+	} else if resp.StatusCode >= 400 {
+		t.countError(status)
+	}
+}
+
+func (t UpstreamTarget) countError(reason string) {
+	metrics.UpstreamErrorsTotal.WithLabelValues(t.Provider, t.endpoint(), reason).Inc()
+}
+
+func (t UpstreamTarget) endpoint() string {
+	if t.Endpoint == "" {
+		return "unknown"
+	}
+	return t.Endpoint
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoffDelay returns a full-jitter exponential backoff for the given attempt
+func backoffDelay(attempt int) time.Duration {
+	ceiling := upstreamBaseBackoff << attempt
+	if ceiling <= 0 || ceiling > upstreamMaxBackoff {
+		ceiling = upstreamMaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// circuitBreaker stops calls to a provider after consecutive failures, then
+// lets a single probe through once the cooldown has passed
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    *slog.Logger
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+}
+
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		cb.probing = true
+		return true
+	case CircuitHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	}
+	return true
+}
+
+// abandon ends a probe whose outcome is unknown so another can be sent
+func (cb *circuitBreaker) abandon() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probing = false
+}
+
+// record counts network errors and 5xx responses as failures; other
+// responses, including 4xx and 429, show the provider is up
+func (cb *circuitBreaker) record(provider string, resp *http.Response, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+	if err == nil && resp.StatusCode < 500 {
+		if cb.state != "" && cb.state != CircuitClosed {
+			cb.logger.Info("Circuit breaker closed", "provider", provider)
+		}
+		cb.state = CircuitClosed
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if err != nil {
+		cb.lastError = err.Error()
+	} else {
+		cb.lastError = fmt.Sprintf("status %d", resp.StatusCode)
+	}
+
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.threshold {
+		if cb.state != CircuitOpen {
+			cb.logger.Warn("Circuit breaker opened", "provider", provider,
+				"consecutive_failures", cb.failures, "last_error", cb.lastError)
+		}
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+func (cb *circuitBreaker) stats(provider string) CircuitBreakerStats {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	stats := CircuitBreakerStats{
+		Provider:            provider,
+		State:               cb.state,
+		ConsecutiveFailures: cb.failures,
+		LastError:           cb.lastError,
+	}
+	if stats.State == "" {
+		stats.State = CircuitClosed
+	}
+	if cb.state == CircuitOpen || cb.state == CircuitHalfOpen {
+		openedAt := cb.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	return stats
+}
+
+// tokenBucket allows bursts of up to capacity requests, refilled at rate per second
+type tokenBucket struct {
+	capacity float64
+	rate     float64
+
+	mu       sync.Mutex
+	tokens   float64
+	lastFill time.Time
+}
+
+func newTokenBucket(capacity int, rate float64) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(capacity),
+		rate:     rate,
+		tokens:   float64(capacity),
+		lastFill: time.Now(),
+	}
+}
+
+// wait blocks until a token is available or the context is done
+func (tb *tokenBucket) wait(ctx context.Context) error {
+	for {
+		delay := tb.take()
+		if delay == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// take consumes a token, or returns how long until one is available
+func (tb *tokenBucket) take() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if tb.rate <= 0 || tb.capacity <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	tb.tokens += now.Sub(tb.lastFill).Seconds() * tb.rate
+	if tb.tokens > tb.capacity {
+		tb.tokens = tb.capacity
+	}
+	tb.lastFill = now
+
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+func (tb *tokenBucket) idleSince(now time.Time) time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return now.Sub(tb.lastFill)
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"marketplace-app/internal/config"
+)
+
+func TestUpstreamRetriesArePaced(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// Two requests per location, then practically none
+	uc := NewUpstreamClient(&config.Config{
+		UpstreamTimeout:            time.Second,
+		UpstreamMaxRetries:         3,
+		UpstreamBreakerThreshold:   10,
+		UpstreamBreakerCooldown:    time.Minute,
+		GoHighLevelRateLimitBurst:  2,
+		GoHighLevelRateLimitPerSec: 0.01,
+	}, testLogger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+	_, err := uc.Do(req, UpstreamTarget{Provider: ProviderGoHighLevel, Endpoint: "test", Resource: "location-1"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the third attempt to wait for the rate limit", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("provider saw %d requests, want retries limited to the burst of 2", got)
+	}
+}
\ No newline at end of file
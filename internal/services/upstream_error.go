@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProviderNango identifies requests made to the Nango API
+const ProviderNango = "nango"
+
+// maxUpstreamErrorBody bounds how much of an error response body is read
+const maxUpstreamErrorBody = 64 << 10
+
+// UpstreamError is an error response from a provider API
+type UpstreamError struct {
+	Provider   string
+	StatusCode int
+	Code       string
+	Message    string
+	RetryAfter time.Duration
+	RequestID  string
+}
+
+func (e *UpstreamError) Error() string {
+	msg := fmt.Sprintf("%s API request failed with status %d", e.Provider, e.StatusCode)
+	if e.Code != "" {
+		msg += fmt.Sprintf(" (%s)", e.Code)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" [request %s]", e.RequestID)
+	}
+	return msg
+}
+
+// ParseUpstreamError builds an UpstreamError from a provider's error response.
+// The body may be any of the common JSON error shapes; anything else is kept
+// as the message verbatim.
+func ParseUpstreamError(provider string, resp *http.Response, body []byte) *UpstreamError {
+	upstreamErr := &UpstreamError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		RequestID:  firstHeader(resp.Header, "X-Request-Id", "X-Correlation-Id", "X-Amzn-Requestid"),
+	}
+
+	var payload struct {
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+		Code             json.RawMessage `json:"code"`
+		Message          json.RawMessage `json:"message"`
+		RequestID        string          `json:"request_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		upstreamErr.Message = strings.TrimSpace(string(body))
+		return upstreamErr
+	}
+
+	// "error" is either an OAuth-style code string or a nested error object
+	var nested struct {
+		Code    json.RawMessage `json:"code"`
+		Message string          `json:"message"`
+	}
+	var errorCode string
+	if json.Unmarshal(payload.Error, &errorCode) == nil {
+		upstreamErr.Code = errorCode
+	} else if json.Unmarshal(payload.Error, &nested) == nil {
+		upstreamErr.Code = rawString(nested.Code)
+		upstreamErr.Message = nested.Message
+	}
+
+	if upstreamErr.Code == "" {
+		upstreamErr.Code = rawString(payload.Code)
+	}
+	if upstreamErr.Message == "" {
+		upstreamErr.Message = payload.ErrorDescription
+	}
+	if upstreamErr.Message == "" {
+		// GoHighLevel sends "message" as either a string or a list of strings
+		var messages []string
+		if json.Unmarshal(payload.Message, &messages) == nil {
+			upstreamErr.Message = strings.Join(messages, "; ")
+		} else {
+			upstreamErr.Message = rawString(payload.Message)
+		}
+	}
+	if upstreamErr.RequestID == "" {
+		upstreamErr.RequestID = payload.RequestID
+	}
+
+	return upstreamErr
+}
+
+// AsUpstreamError returns the UpstreamError in err's chain, if any
+func AsUpstreamError(err error) (*UpstreamError, bool) {
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr, true
+	}
+	return nil, false
+}
+
+// Helper functions
+
+// upstreamStatus returns the HTTP status of an upstream error, or 0 if err
+// did not come from an upstream response
+func upstreamStatus(err error) int {
+	if upstreamErr, ok := AsUpstreamError(err); ok {
+		return upstreamErr.StatusCode
+	}
+	return 0
+}
+
+// parseRetryAfter accepts either delay seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+func firstHeader(header http.Header, names ...string) string {
+	for _, name := range names {
+		if value := header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// rawString renders a JSON string or number as plain text
+func rawString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
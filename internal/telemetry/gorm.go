@@ -0,0 +1,108 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// gormOperations are the GORM callback chains that get a span per statement
+var gormOperations = []string{"create", "query", "update", "delete", "row", "raw"}
+
+// gormSpanKey stores a statement's span between its before and after callbacks
+const gormSpanKey = "otel:span"
+
+// InstrumentGORM registers callbacks that record a client span for every
+// statement run through db. Spans are children of the span in the
+// statement's context, so queries must be made with db.WithContext.
+func InstrumentGORM(db *gorm.DB) error {
+	for _, operation := range gormOperations {
+		registerBefore, registerAfter := gormRegistrars(db, operation)
+		before := "otel:before_" + operation
+		after := "otel:after_" + operation
+
+		if err := registerBefore(before, startGORMSpan(operation)); err != nil {
+			return fmt.Errorf("failed to register %s: %w", before, err)
+		}
+		if err := registerAfter(after, endGORMSpan); err != nil {
+			return fmt.Errorf("failed to register %s: %w", after, err)
+		}
+	}
+	return nil
+}
+
+type gormRegisterFunc func(name string, fn func(*gorm.DB)) error
+
+// gormRegistrars returns functions registering callbacks around an operation
+func gormRegistrars(db *gorm.DB, operation string) (gormRegisterFunc, gormRegisterFunc) {
+	callbacks := db.Callback()
+	hook := "gorm:" + operation
+	switch operation {
+	case "create":
+		return callbacks.Create().Before(hook).Register, callbacks.Create().After(hook).Register
+	case "query":
+		return callbacks.Query().Before(hook).Register, callbacks.Query().After(hook).Register
+	case "update":
+		return callbacks.Update().Before(hook).Register, callbacks.Update().After(hook).Register
+	case "delete":
+		return callbacks.Delete().Before(hook).Register, callbacks.Delete().After(hook).Register
+	case "row":
+		return callbacks.Row().Before(hook).Register, callbacks.Row().After(hook).Register
+	default:
+		return callbacks.Raw().Before(hook).Register, callbacks.Raw().After(hook).Register
+	}
+}
+
+func startGORMSpan(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Statement == nil || tx.Statement.Context == nil {
+			return
+		}
+
+		name := "gorm." + operation
+		if tx.Statement.Table != "" {
+			name += " " + tx.Statement.Table
+		}
+
+		ctx, span := Tracer().Start(tx.Statement.Context, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemPostgreSQL,
+				semconv.DBOperation(operation),
+				semconv.DBSQLTable(tx.Statement.Table),
+			),
+		)
+		if requestID := RequestID(ctx); requestID != "" {
+			span.SetAttributes(attribute.String("request.id", requestID))
+		}
+		tx.Statement.Context = ctx
+		tx.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func endGORMSpan(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+
+	// The statement holds placeholders; bound values are not recorded
+	span.SetAttributes(
+		semconv.DBStatement(tx.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	if err := tx.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,72 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook records a client span for every Redis command or pipeline.
+// Only command names are recorded, never keys or values.
+type RedisHook struct{}
+
+var _ redis.Hook = RedisHook{}
+
+func (RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = Tracer().Start(ctx, "redis."+cmd.Name(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBOperation(cmd.Name()),
+		),
+	)
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedisSpan(trace.SpanFromContext(ctx), cmd.Err())
+	return nil
+}
+
+func (RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+
+	ctx, _ = Tracer().Start(ctx, "redis.pipeline",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBOperation(strings.Join(names, " ")),
+			attribute.Int("db.redis.num_cmd", len(cmds)),
+		),
+	)
+	return ctx, nil
+}
+
+func (RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+			err = cmdErr
+			break
+		}
+	}
+	endRedisSpan(trace.SpanFromContext(ctx), err)
+	return nil
+}
+
+// endRedisSpan ends the span, marking it failed unless the error is a cache miss
+func endRedisSpan(span trace.Span, err error) {
+	if err != nil && err != redis.Nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
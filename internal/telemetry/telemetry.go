@@ -0,0 +1,97 @@
+// Package telemetry sets up OpenTelemetry tracing and carries request-scoped
+// identifiers through contexts
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"marketplace-app/internal/config"
+)
+
+// instrumentationName identifies spans created by this application
+const instrumentationName = "marketplace-app"
+
+// Trace exporters selectable with OTEL_TRACES_EXPORTER
+const (
+	ExporterOTLP = "otlp"
+	ExporterNone = "none"
+)
+
+// Tracer returns the application's tracer from the global provider
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Init installs the global tracer provider and W3C trace context propagator.
+// Spans are sent to exporter when one is given, which lets tests capture
+// them with an in-memory exporter; otherwise the exporter is chosen by
+// cfg.TracesExporter, with the OTLP endpoint, headers and sampler read from
+// the standard OTEL_* environment variables. The returned function flushes
+// and stops the provider.
+func Init(ctx context.Context, cfg *config.Config, exporter sdktrace.SpanExporter) (func(context.Context) error, error) {
+	exporterName := "custom"
+	if exporter == nil {
+		exporterName = cfg.TracesExporter
+		switch cfg.TracesExporter {
+		case ExporterOTLP:
+			otlp, err := otlptracehttp.New(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+			}
+			exporter = otlp
+		case ExporterNone, "":
+			exporterName = ExporterNone
+		default:
+			return nil, fmt.Errorf("unsupported trace exporter %q", cfg.TracesExporter)
+		}
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceInstanceID(cfg.InstanceID),
+		semconv.DeploymentEnvironment(cfg.Environment),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	options := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if exporter != nil {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+
+	// Without an exporter spans are still created so trace IDs propagate to
+	// logs and downstream services
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	slog.Info("Tracing initialized", "exporter", exporterName)
+	return provider.Shutdown, nil
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, if any
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
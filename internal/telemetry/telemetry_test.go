@@ -0,0 +1,129 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"marketplace-app/internal/config"
+)
+
+func TestRequestTracing(t *testing.T) {
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := Init(ctx, &config.Config{ServiceName: "marketplace-app", InstanceID: "test"}, exporter)
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer shutdown(ctx)
+
+	// The downstream service sees the trace context of the outbound call
+	var traceparent string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer downstream.Close()
+	client := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer conn.Close()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := InstrumentGORM(db); err != nil {
+		t.Fatalf("InstrumentGORM: %v", err)
+	}
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "companies"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(otelgin.Middleware("marketplace-app"))
+	router.GET("/companies/:companyId", func(c *gin.Context) {
+		var count int64
+		if err := db.WithContext(c.Request.Context()).Table("companies").Count(&count).Error; err != nil {
+			t.Errorf("query: %v", err)
+		}
+		req, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, downstream.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("outbound call: %v", err)
+			return
+		}
+		resp.Body.Close()
+		c.Status(http.StatusOK)
+	})
+
+	// The request continues the caller's trace
+	const incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/companies/company-1", nil)
+	req.Header.Set("traceparent", "00-"+incomingTraceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(ctx); err != nil {
+		t.Fatalf("ForceFlush: %v", err)
+	}
+	spans := exporter.GetSpans()
+
+	request := findSpan(t, spans, "/companies/:companyId")
+	if request.SpanKind != trace.SpanKindServer || request.SpanContext.TraceID().String() != incomingTraceID {
+		t.Errorf("got request span %v in trace %s, want a server span in the incoming trace", request.SpanKind, request.SpanContext.TraceID())
+	}
+
+	query := findSpan(t, spans, "gorm.query companies")
+	if query.Parent.SpanID() != request.SpanContext.SpanID() {
+		t.Error("expected the GORM span to be a child of the request span")
+	}
+
+	var outbound tracetest.SpanStub
+	for _, span := range spans {
+		if span.SpanKind == trace.SpanKindClient && span.Parent.SpanID() == request.SpanContext.SpanID() && !strings.HasPrefix(span.Name, "gorm.") {
+			outbound = span
+		}
+	}
+	if !outbound.SpanContext.IsValid() {
+		t.Fatalf("expected an outbound HTTP span under the request span, got %v", spanNames(spans))
+	}
+	want := "00-" + incomingTraceID + "-" + outbound.SpanContext.SpanID().String() + "-01"
+	if traceparent != want {
+		t.Errorf("got traceparent %q, want %q", traceparent, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span %q in %v", name, spanNames(spans))
+	return tracetest.SpanStub{}
+}
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name
+	}
+	return names
+}
\ No newline at end of file
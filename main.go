@@ -1,37 +1,67 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"marketplace-app/internal/api"
 	"marketplace-app/internal/config"
 	"marketplace-app/internal/database"
+	"marketplace-app/internal/logging"
+	"marketplace-app/internal/metrics"
 	"marketplace-app/internal/services"
+	"marketplace-app/internal/telemetry"
 )
 
 func main() {
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found")
-	}
+	envErr := godotenv.Load()
 
 	// Initialize configuration
 	cfg := config.Load()
 
+	// Initialize structured logging; the log package and slog's package
+	// functions write through the same logger
+	logger := logging.New(cfg)
+	slog.SetDefault(logger)
+	if envErr != nil {
+		logger.Info("No .env file found")
+	}
+
+	// Initialize tracing before anything makes traced calls
+	shutdownTracing, err := telemetry.Init(context.Background(), cfg, nil)
+	if err != nil {
+		fatal(logger, "Failed to initialize tracing", err)
+	}
+
 	// Initialize database
-	db, err := database.Initialize(cfg.DatabaseURL)
+	gormLogger := logging.NewGORMLogger(logger.With("component", "database"), cfg.LogLevel, cfg.DBSlowQueryThreshold)
+	db, err := database.Initialize(cfg.DatabaseURL, gormLogger)
 	if err != nil {
-		log.Fatal("Failed to initialize database:", err)
+		fatal(logger, "Failed to initialize database", err)
 	}
 
 	// Initialize services
-	services := services.NewServices(db, cfg)
+	services := services.NewServices(db, cfg, logger)
 
-	// Initialize router
-	router := gin.Default()
+	// Export database pool and business entity gauges
+	if cfg.MetricsEnabled {
+		if sqlDB, err := db.DB(); err == nil {
+			metrics.RegisterDBStats(sqlDB)
+		}
+		metrics.RegisterBusinessCollector(services.Business.CountEntities, time.Minute)
+	}
+
+	// Initialize router; logging and recovery middleware are added by SetupRoutes
+	router := gin.New()
 
 	// Setup API routes
 	api.SetupRoutes(router, services, cfg)
@@ -42,8 +72,59 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Server starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+
+	go func() {
+		logger.Info("Server starting", "port", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal(logger, "Failed to start server", err)
+		}
+	}()
+
+	// Start background services
+	if err := services.Start(); err != nil {
+		fatal(logger, "Failed to start background services", err)
+	}
+
+	// Wait for a termination signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+
+	// Fail readiness first so the load balancer stops sending new requests
+	// before connections are closed
+	logger.Info("Received signal, draining", "signal", sig.String(), "drain_period", cfg.ShutdownDrainPeriod.String())
+	services.BeginDrain()
+	time.Sleep(cfg.ShutdownDrainPeriod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting connections and wait for in-flight requests
+	logger.Info("Shutting down server")
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warn("Server shutdown did not complete", "error", err)
 	}
+
+	// Then stop background work, flush alerts and close the cache and database
+	services.Shutdown(ctx)
+	if err := database.Close(db); err != nil {
+		logger.Error("Failed to close database", "error", err)
+	}
+
+	// Flush buffered spans last so shutdown work is traced
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Warn("Failed to flush traces", "error", err)
+	}
+
+	logger.Info("Server stopped")
+}
+
+// fatal logs err and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
 }
\ No newline at end of file